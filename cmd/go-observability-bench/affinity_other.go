@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"runtime"
+)
+
+// availableCPUs returns the CPUs the process is allowed to run on.
+func availableCPUs() ([]int, error) {
+	cpus := make([]int, runtime.NumCPU())
+	for i := range cpus {
+		cpus[i] = i
+	}
+	return cpus, nil
+}
+
+func setAffinity(cpus []int) error {
+	return errors.New("cpu affinity is only supported on linux")
+}
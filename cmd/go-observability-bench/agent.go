@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+// fakeAgent is an in-process stand-in for the Datadog agent. It accepts
+// any request, counts it and responds with an empty JSON object.
+type fakeAgent struct {
+	server *httptest.Server
+	// keep causes request bodies to be kept until they are drained via
+	// WriteTo.
+	keep bool
+
+	mu    sync.Mutex
+	body  bytes.Buffer
+	stats internal.AgentStats
+}
+
+func newFakeAgent(keep bool) *fakeAgent {
+	a := &fakeAgent{keep: keep}
+	a.server = httptest.NewServer(a)
+	return a
+}
+
+// Addr returns the host:port the agent is listening on.
+func (a *fakeAgent) Addr() string {
+	return strings.TrimPrefix(a.server.URL, "http://")
+}
+
+func (a *fakeAgent) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	a.stats.Requests++
+	a.stats.Bytes += int64(len(data))
+	if a.keep {
+		a.body.Write(data)
+	}
+	a.mu.Unlock()
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write([]byte("{}"))
+}
+
+// WriteTo writes all request bodies received since the last call to w.
+func (a *fakeAgent) WriteTo(w io.Writer) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.body.WriteTo(w)
+}
+
+// Stats returns the number of requests and bytes received so far.
+func (a *fakeAgent) Stats() internal.AgentStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stats
+}
+
+func (a *fakeAgent) Close() {
+	a.server.Close()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupCPUPeriod is the cpu.max period used for CPU quotas.
+const cgroupCPUPeriod = 100 * time.Millisecond
+
+// cgroupManager creates the cgroups of the runs below a cgroup of its own. It
+// requires a cgroup v2 hierarchy with the cpu and memory controllers
+// delegated to the cgroup of the process.
+type cgroupManager struct {
+	// parent is the cgroup the coordinator was started in.
+	parent string
+	// leaf is the cgroup below parent the coordinator moved itself into, it's
+	// empty if the coordinator didn't have to move.
+	leaf string
+	base string
+}
+
+func newCgroupManager() (*cgroupManager, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, errors.New("cgroup v2 is not mounted at " + cgroupRoot)
+	}
+	self, err := selfCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	// Controllers can only be enabled for the children of a cgroup without
+	// processes of its own (except for the root), so the coordinator moves
+	// itself into a leaf first if needed.
+	m := &cgroupManager{parent: filepath.Join(cgroupRoot, self)}
+	if err := enableControllers(m.parent); errors.Is(err, syscall.EBUSY) {
+		leaf := filepath.Join(m.parent, fmt.Sprintf("go-observability-bench-coordinator-%d", os.Getpid()))
+		if err := os.Mkdir(leaf, 0755); err != nil {
+			return nil, err
+		} else if err := writeCgroupFile(leaf, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+			os.Remove(leaf)
+			return nil, err
+		}
+		m.leaf = leaf
+		if err := enableControllers(m.parent); err != nil {
+			m.Close()
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	base := filepath.Join(m.parent, fmt.Sprintf("go-observability-bench-%d", os.Getpid()))
+	if err := os.Mkdir(base, 0755); err != nil {
+		m.Close()
+		return nil, err
+	}
+	m.base = base
+	if err := enableControllers(m.base); err != nil {
+		m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Cgroup creates a cgroup for the run with the given name and limits. A
+// cpuQuota of 1.5 allows the run to use 1.5 CPUs, memoryLimit is in bytes.
+// Zero values leave the limit unset.
+func (m *cgroupManager) Cgroup(name string, cpuQuota float64, memoryLimit int64) (*cgroup, error) {
+	cg := &cgroup{path: filepath.Join(m.base, strings.ReplaceAll(name, "/", "_"))}
+	if err := os.Mkdir(cg.path, 0755); err != nil {
+		return nil, err
+	}
+	if cpuQuota > 0 {
+		quota := time.Duration(cpuQuota * float64(cgroupCPUPeriod))
+		max := fmt.Sprintf("%d %d", quota.Microseconds(), cgroupCPUPeriod.Microseconds())
+		if err := writeCgroupFile(cg.path, "cpu.max", max); err != nil {
+			cg.Close()
+			return nil, err
+		}
+	}
+	if memoryLimit > 0 {
+		if err := writeCgroupFile(cg.path, "memory.max", strconv.FormatInt(memoryLimit, 10)); err != nil {
+			cg.Close()
+			return nil, err
+		}
+	}
+	return cg, nil
+}
+
+// Close removes the cgroups created by m and moves the coordinator back to
+// the cgroup it was started in. The cgroups of all runs must be closed first.
+func (m *cgroupManager) Close() error {
+	if m.base != "" {
+		if err := os.Remove(m.base); err != nil {
+			return err
+		}
+	}
+	if m.leaf == "" {
+		return nil
+	}
+	// The parent can't have processes of its own while controllers are
+	// enabled for its children, and it had none enabled before.
+	if err := disableControllers(m.parent); err != nil {
+		return err
+	} else if err := writeCgroupFile(m.parent, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+		return err
+	}
+	return os.Remove(m.leaf)
+}
+
+type cgroup struct {
+	path string
+	dir  *os.File
+}
+
+// Attach causes cmd to be started inside of the cgroup.
+func (cg *cgroup) Attach(cmd *exec.Cmd) error {
+	dir, err := os.Open(cg.path)
+	if err != nil {
+		return err
+	}
+	cg.dir = dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{UseCgroupFD: true, CgroupFD: int(dir.Fd())}
+	return nil
+}
+
+// Stat returns the CPU usage and throttling counters of the cgroup.
+func (cg *cgroup) Stat() (internal.CgroupStat, error) {
+	var stat internal.CgroupStat
+	file, err := os.Open(filepath.Join(cg.path, "cpu.stat"))
+	if err != nil {
+		return stat, err
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		val, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return stat, fmt.Errorf("cpu.stat: %s: %w", fields[0], err)
+		}
+		switch fields[0] {
+		case "usage_usec":
+			stat.Usage = time.Duration(val) * time.Microsecond
+		case "user_usec":
+			stat.User = time.Duration(val) * time.Microsecond
+		case "system_usec":
+			stat.System = time.Duration(val) * time.Microsecond
+		case "nr_periods":
+			stat.Periods = val
+		case "nr_throttled":
+			stat.Throttled = val
+		case "throttled_usec":
+			stat.ThrottledTime = time.Duration(val) * time.Microsecond
+		}
+	}
+	return stat, s.Err()
+}
+
+func (cg *cgroup) Close() error {
+	if cg.dir != nil {
+		cg.dir.Close()
+	}
+	return os.Remove(cg.path)
+}
+
+// selfCgroup returns the cgroup v2 path of the process.
+func selfCgroup() (string, error) {
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::"), nil
+		}
+	}
+	return "", errors.New("process is not in a cgroup v2 hierarchy")
+}
+
+func enableControllers(path string) error {
+	return writeCgroupFile(path, "cgroup.subtree_control", "+cpu +memory")
+}
+
+func disableControllers(path string) error {
+	return writeCgroupFile(path, "cgroup.subtree_control", "-cpu -memory")
+}
+
+func writeCgroupFile(dir, name, val string) error {
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(val), 0644)
+}
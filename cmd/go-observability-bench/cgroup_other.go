@@ -0,0 +1,30 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+type cgroupManager struct{}
+
+func newCgroupManager() (*cgroupManager, error) {
+	return nil, errors.New("cgroups are only supported on linux")
+}
+
+func (m *cgroupManager) Cgroup(name string, cpuQuota float64, memoryLimit int64) (*cgroup, error) {
+	return nil, errors.New("cgroups are only supported on linux")
+}
+
+func (m *cgroupManager) Close() error { return nil }
+
+type cgroup struct{}
+
+func (cg *cgroup) Attach(cmd *exec.Cmd) error { return nil }
+
+func (cg *cgroup) Stat() (internal.CgroupStat, error) { return internal.CgroupStat{}, nil }
+
+func (cg *cgroup) Close() error { return nil }
@@ -2,12 +2,15 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/felixge/go-observability-bench/internal"
@@ -25,91 +28,318 @@ type Coordinator struct {
 	Bin string
 	// Enable verbose output
 	Verbose bool
+	// Resume skips the runs that have been completed by a previous session
+	// in Outdir instead of removing it.
+	Resume bool
+	// Parallel is the number of runs to execute at the same time. Each of
+	// them is pinned to a disjoint set of CPUs with GOMAXPROCS set to its
+	// size.
+	Parallel int
+
+	// cgroups is created if any run has cgroup limits, cgroupsErr is set if
+	// the host doesn't permit it.
+	cgroups    *cgroupManager
+	cgroupsErr error
 }
 
 func (c *Coordinator) Run() error {
-	if err := os.RemoveAll(c.Outdir); err != nil {
+	// Validate the config before touching the outdir, so a typo doesn't
+	// remove the results of a previous session.
+	config, configData, err := c.readConfig()
+	if err != nil {
 		return err
 	}
+	if !c.Resume {
+		if err := os.RemoveAll(c.Outdir); err != nil {
+			return err
+		}
+	}
 
-	config, err := internal.ReadConfig(c.Config)
-	if err != nil {
+	configHash := fmt.Sprintf("%x", sha256.Sum256(configData))
+
+	session, err := internal.ReadSession(c.Outdir)
+	if err == nil {
+		if session.ConfigHash != configHash {
+			return fmt.Errorf("can't resume: %s has changed since the session was started", c.Config)
+		}
+		session.Resumed = append(session.Resumed, time.Now())
+	} else if os.IsNotExist(err) {
+		session = &internal.Session{
+			Config:     c.Config,
+			ConfigHash: configHash,
+			Seed:       config.Seed,
+			Start:      time.Now(),
+		}
+		if session.Seed == 0 {
+			session.Seed = time.Now().UnixNano()
+		}
+	} else {
 		return err
 	}
 
+	parallel := c.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	var cpuSets [][]int
+	if parallel > 1 {
+		if cpuSets, err = splitCPUs(parallel); err != nil {
+			return err
+		}
+	}
+
 	runs, err := c.runConfigs(config)
 	if err != nil {
 		return err
 	}
+	runs, err = schedule(runs, config.Schedule, session.Seed)
+	if err != nil {
+		return err
+	}
 
 	var maxNameLength int
 	var totalDuration time.Duration
+	var todo []internal.RunConfig
+	session.Runs = nil
 	for _, run := range runs {
 		if len(run.Name) > maxNameLength {
 			maxNameLength = len(run.Name)
 		}
-		totalDuration += run.Duration
+		status := internal.RunPending
+		if c.Resume && runComplete(run) {
+			status = internal.RunDone
+		} else {
+			todo = append(todo, run)
+			totalDuration += run.Warmup + run.Duration + run.Cooldown
+		}
+		session.Runs = append(session.Runs, internal.SessionRun{Name: run.Name, Status: status})
 	}
 
-	fmt.Printf("starting %d runs, expected duration: %s\n\n", len(runs), totalDuration)
-	for _, run := range runs {
-		if err := c.run(run, maxNameLength); err != nil {
+	if err := os.MkdirAll(c.Outdir, 0755); err != nil {
+		return err
+	} else if err := session.Write(c.Outdir); err != nil {
+		return err
+	}
+
+	for _, run := range todo {
+		if run.CPUQuota > 0 || run.MemoryLimit > 0 {
+			if c.cgroups, c.cgroupsErr = newCgroupManager(); c.cgroupsErr != nil {
+				fmt.Printf("warning: running without cgroup limits: %s\n", c.cgroupsErr)
+			} else {
+				defer func() {
+					if err := c.cgroups.Close(); err != nil {
+						fmt.Printf("warning: removing cgroups: %s\n", err)
+					}
+				}()
+			}
+			break
+		}
+	}
+
+	fmt.Printf("starting %d runs, expected duration: %s, schedule: %s", len(todo), totalDuration/time.Duration(parallel), config.Schedule)
+	if config.Schedule == internal.ScheduleRandom {
+		fmt.Printf(" (seed: %d)", session.Seed)
+	}
+	if parallel > 1 {
+		fmt.Printf(", parallel: %d", parallel)
+	}
+	if skipped := len(runs) - len(todo); skipped > 0 {
+		fmt.Printf(", resuming after %d completed runs", skipped)
+	}
+	fmt.Printf("\n\n")
+
+	// Every worker executes one run at a time on its own set of CPUs. The
+	// output of parallel runs is buffered so their lines don't interleave.
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	todoCh := make(chan internal.RunConfig)
+	for i := 0; i < parallel; i++ {
+		var cpus []int
+		if cpuSets != nil {
+			cpus = cpuSets[i]
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range todoCh {
+				run.CPUs = cpus
+				err := c.runAndRecord(run, maxNameLength, parallel > 1, session, &mu)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, run := range todo {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		todoCh <- run
+	}
+	close(todoCh)
+	wg.Wait()
+	return firstErr
+}
+
+// runAndRecord executes run and records its status in session. mu guards
+// session and stdout.
+func (c *Coordinator) runAndRecord(run internal.RunConfig, maxNameLength int, buffered bool, session *internal.Session, mu *sync.Mutex) error {
+	// Remove the leftovers of a previous attempt.
+	if err := os.RemoveAll(run.Outdir); err != nil {
+		return err
+	}
+	if buffered {
+		var out bytes.Buffer
+		err := c.run(run, maxNameLength, &out)
+		mu.Lock()
+		os.Stdout.Write(out.Bytes())
+		mu.Unlock()
+		if err != nil {
 			return err
 		}
+	} else if err := c.run(run, maxNameLength, os.Stdout); err != nil {
+		return err
 	}
-	return nil
+
+	status := internal.RunFailed
+	if runComplete(run) {
+		status = internal.RunDone
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	session.Runs[run.Order].Status = status
+	return session.Write(c.Outdir)
+}
+
+// cgroup creates a cgroup with the limits of rc.
+func (c *Coordinator) cgroup(rc internal.RunConfig) (*cgroup, error) {
+	if c.cgroupsErr != nil {
+		return nil, c.cgroupsErr
+	}
+	return c.cgroups.Cgroup(rc.Name, rc.CPUQuota, rc.MemoryLimit)
+}
+
+// splitCPUs splits the CPUs available to the process into n disjoint sets of
+// equal size. Left over CPUs are not used.
+func splitCPUs(n int) ([][]int, error) {
+	cpus, err := availableCPUs()
+	if err != nil {
+		return nil, err
+	}
+	size := len(cpus) / n
+	if size == 0 {
+		return nil, fmt.Errorf("can't run %d runs in parallel on %d cpus", n, len(cpus))
+	}
+	sets := make([][]int, n)
+	for i := range sets {
+		sets[i] = cpus[i*size : (i+1)*size]
+	}
+	return sets, nil
 }
 
-func (c Coordinator) runConfigs(config internal.Config) ([]internal.RunConfig, error) {
+// runComplete returns true if the outdir of rc contains a meta.yaml and an
+// ops.csv or histogram file with the number of ops recorded in it.
+func runComplete(rc internal.RunConfig) bool {
+	data, err := ioutil.ReadFile(filepath.Join(rc.Outdir, "meta.yaml"))
+	if err != nil {
+		return false
+	}
+	meta := &RunMeta{}
+	if err := yaml.Unmarshal(data, meta); err != nil || meta.Name != rc.Name {
+		return false
+	}
+	if rc.Histogram > 0 {
+		hist, err := internal.ReadHistogram(filepath.Join(rc.Outdir, internal.HistogramFile))
+		return err == nil && hist.Count == meta.Stats.OpsCount
+	}
+	ops, err := ReadOps(filepath.Join(rc.Outdir, "ops.csv"))
+	if err != nil {
+		return false
+	}
+	var measured int
+	for _, op := range ops {
+		if op.Measured() {
+			measured++
+		}
+	}
+	return measured == meta.Stats.OpsCount
+}
+
+func (c *Coordinator) runConfigs(config internal.Config) ([]internal.RunConfig, error) {
 	dupeNames := map[string]int{}
 	var runConfigs []internal.RunConfig
 	for i := 0; i < config.Repeat; i++ {
 		for _, jc := range config.Jobs {
-			for _, workload := range jc.Workload {
-				for _, concurrency := range jc.Concurrency {
-					for _, duration := range jc.Duration {
-						for _, profile := range jc.Profile {
-							if profile.Period == 0 {
-								profile.Period = duration
-							}
-
-							for _, args := range jc.Args {
-								name := expand(jc.Name, map[string]interface{}{
-									"iteration":        i,
-									"workload":         workload,
-									"concurrency":      concurrency,
-									"duration":         duration,
-									"profile_period":   profile.Period,
-									"profile_cpu":      profile.CPU,
-									"profile_mem":      profile.Mem,
-									"profile_mem_rate": profile.MemRate,
-									"profilers":        strings.Join(profile.Profilers(), ","),
-								})
-
-								dupeNames[name]++
-								count := dupeNames[name]
-								if count > 1 {
-									name = fmt.Sprintf("%s.%d", name, count)
-								}
-
-								argsData, err := yaml.Marshal(args)
-								if err != nil {
-									return nil, err
-								}
-								runConf := internal.RunConfig{
-									Name:        name,
-									Iteration:   i,
-									Workload:    workload,
-									Concurrency: concurrency,
-									Duration:    duration,
-									Profile:     profile,
-									Args:        string(argsData),
-									Outdir:      filepath.Join(c.Outdir, name),
-								}
-								runConfigs = append(runConfigs, runConf)
-							}
-						}
+			for _, e := range jc.Matrix() {
+				profile := e.Profile
+				if profile.Period == 0 {
+					profile.Period = e.Duration
+				}
+				if profile.Datadog && profile.DatadogCPUDuration == 0 {
+					// Same ratio as the profiler's defaults of 15s per 60s period.
+					profile.DatadogCPUDuration = profile.Period / 4
+				}
+				if profile.Sink == "" {
+					profile.Sink = internal.ProfileSinkDisk
+				}
+
+				for _, args := range jc.ArgsFor(e.Workload) {
+					name := expand(jc.Name, map[string]interface{}{
+						"iteration":        i,
+						"workload":         e.Workload,
+						"concurrency":      e.Concurrency,
+						"duration":         e.Duration,
+						"profile_period":   profile.Period,
+						"profile_cpu":      profile.CPU,
+						"profile_mem":      profile.Mem,
+						"profile_mem_rate": profile.MemRate,
+						"profile_sink":     profile.Sink,
+						"profilers":        profile.Label(),
+						"tracing":          e.Tracing,
+						"rate":             jc.Rate,
+					})
+
+					dupeNames[name]++
+					count := dupeNames[name]
+					if count > 1 {
+						name = fmt.Sprintf("%s.%d", name, count)
 					}
+
+					argsData, err := yaml.Marshal(&args)
+					if err != nil {
+						return nil, err
+					}
+					runConf := internal.RunConfig{
+						Name:            name,
+						Iteration:       i,
+						Workload:        e.Workload,
+						Concurrency:     e.Concurrency,
+						Duration:        e.Duration,
+						Warmup:          jc.Warmup,
+						Cooldown:        jc.Cooldown,
+						Profile:         profile,
+						Tracing:         e.Tracing,
+						Rate:            jc.Rate,
+						Arrival:         jc.Arrival,
+						Histogram:       jc.Histogram,
+						MetricsInterval: jc.MetricsInterval,
+						PerfCounters:    jc.PerfCounters,
+						CPUQuota:        jc.CPUQuota,
+						MemoryLimit:     jc.MemoryLimit,
+						Args:            string(argsData),
+						Outdir:          filepath.Join(c.Outdir, name),
+					}
+					runConfigs = append(runConfigs, runConf)
 				}
 			}
 		}
@@ -117,8 +347,8 @@ func (c Coordinator) runConfigs(config internal.Config) ([]internal.RunConfig, e
 	return runConfigs, nil
 }
 
-func (c *Coordinator) run(rc internal.RunConfig, maxNameLength int) error {
-	fmt.Printf("%s %s", rc.Name, strings.Repeat(" ", maxNameLength-len(rc.Name)))
+func (c *Coordinator) run(rc internal.RunConfig, maxNameLength int, w io.Writer) error {
+	fmt.Fprintf(w, "%s %s", rc.Name, strings.Repeat(" ", maxNameLength-len(rc.Name)))
 
 	workloadData, err := yaml.Marshal(rc)
 	if err != nil {
@@ -135,9 +365,25 @@ func (c *Coordinator) run(rc internal.RunConfig, maxNameLength int) error {
 	child.Stdout = &out
 	child.Stderr = os.Stderr
 
+	var (
+		cg     *cgroup
+		cgStat *internal.CgroupStat
+	)
+	if rc.CPUQuota > 0 || rc.MemoryLimit > 0 {
+		cg, err = c.cgroup(rc)
+		if err == nil {
+			defer cg.Close()
+			err = cg.Attach(child)
+		}
+		if err != nil {
+			cgStat = &internal.CgroupStat{Error: err.Error()}
+			cg = nil
+		}
+	}
+
 	if c.Verbose {
-		fmt.Printf("\n")
-		fmt.Printf(
+		fmt.Fprintf(w, "\n")
+		fmt.Fprintf(w,
 			"%s << EOF\n%s\nEOF\n",
 			strings.Join(child.Args, " "),
 			workloadData,
@@ -145,54 +391,83 @@ func (c *Coordinator) run(rc internal.RunConfig, maxNameLength int) error {
 	}
 
 	if err := child.Run(); err != nil {
-		fmt.Printf("error: %s\n", err)
+		fmt.Fprintf(w, "error: %s\n", err)
 		return nil
 	}
+	if cg != nil {
+		stat, err := cg.Stat()
+		if err != nil {
+			stat.Error = err.Error()
+		}
+		cgStat = &stat
+	}
 
 	meta := &RunMeta{}
 	if err := yaml.Unmarshal(out.Bytes(), &meta); err != nil {
-		fmt.Printf("error: %s\n", err)
-		return nil
-	}
-
-	ops, err := ReadOps(filepath.Join(rc.Outdir, "ops.csv"))
-	if err != nil {
-		fmt.Printf("error: %s\n", err)
+		fmt.Fprintf(w, "error: %s\n", err)
 		return nil
 	}
 
 	var errors int
-	var (
-		totalDuration time.Duration
-		minDuration   time.Duration
-		maxDuration   time.Duration
-	)
 	var firstErr string
-	for _, op := range ops {
-		totalDuration += op.Duration
-		if op.Duration < minDuration || minDuration == 0 {
-			minDuration = op.Duration
+	if rc.Histogram > 0 {
+		hist, err := internal.ReadHistogram(filepath.Join(rc.Outdir, internal.HistogramFile))
+		if err != nil {
+			fmt.Fprintf(w, "error: %s\n", err)
+			return nil
 		}
-		if op.Duration > maxDuration {
-			maxDuration = op.Duration
+		meta.Stats.OpsCount = hist.Count
+		meta.Stats.AvgDuration = hist.Mean()
+		meta.Stats.MinDuration = hist.Min
+		meta.Stats.MaxDuration = hist.Max
+		meta.Stats.TotalDuration = hist.Sum
+		errors = hist.Errors
+	} else {
+		ops, err := ReadOps(filepath.Join(rc.Outdir, "ops.csv"))
+		if err != nil {
+			fmt.Fprintf(w, "error: %s\n", err)
+			return nil
 		}
-		if op.Error != "" {
-			errors++
-			if firstErr == "" {
-				firstErr = fmt.Sprintf(" (%s)", op.Error)
+
+		var (
+			totalDuration time.Duration
+			minDuration   time.Duration
+			maxDuration   time.Duration
+		)
+		var measured int
+		for _, op := range ops {
+			if !op.Measured() {
+				continue
+			}
+			measured++
+			totalDuration += op.Duration
+			if op.Duration < minDuration || minDuration == 0 {
+				minDuration = op.Duration
+			}
+			if op.Duration > maxDuration {
+				maxDuration = op.Duration
+			}
+			if op.Error != "" {
+				errors++
+				if firstErr == "" {
+					firstErr = fmt.Sprintf(" (%s)", op.Error)
+				}
 			}
 		}
+		var avgDuration time.Duration
+		if measured > 0 {
+			avgDuration = totalDuration / time.Duration(measured)
+		}
+		meta.Stats.OpsCount = measured
+		meta.Stats.AvgDuration = avgDuration
+		meta.Stats.TotalDuration = totalDuration
+		meta.Stats.MinDuration = minDuration
+		meta.Stats.MaxDuration = maxDuration
 	}
-	var avgDuration time.Duration
-	if len(ops) > 0 {
-		avgDuration = totalDuration / time.Duration(len(ops))
-	}
-	meta.Stats.OpsCount = len(ops)
-	meta.Stats.AvgDuration = avgDuration
-	meta.Stats.TotalDuration = totalDuration
-	meta.Stats.MinDuration = minDuration
-	meta.Stats.MaxDuration = maxDuration
+	meta.Stats.Errors = errors
+	meta.Cgroup = cgStat
 
+	avgDuration := meta.Stats.AvgDuration
 	magnitude := time.Duration(1)
 	for {
 		if magnitude > avgDuration {
@@ -204,7 +479,7 @@ func (c *Coordinator) run(rc internal.RunConfig, maxNameLength int) error {
 
 	metaYAML, err := yaml.Marshal(meta)
 	if err != nil {
-		fmt.Printf("error: %s\n", err)
+		fmt.Fprintf(w, "error: %s\n", err)
 		return nil
 	}
 	metaPath := filepath.Join(rc.Outdir, "meta.yaml")
@@ -212,6 +487,6 @@ func (c *Coordinator) run(rc internal.RunConfig, maxNameLength int) error {
 		return err
 	}
 
-	fmt.Printf("ops=%d avg=%s errors=%d%s\n", len(ops), avgDuration, errors, firstErr)
+	fmt.Fprintf(w, "ops=%d avg=%s errors=%d%s\n", meta.Stats.OpsCount, avgDuration, errors, firstErr)
 	return nil
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+// interarrival returns a function that returns the time between the intended
+// start of two ops for the given rate (ops/s) and arrival process.
+func interarrival(rate float64, arrival string) (func() time.Duration, error) {
+	mean := float64(time.Second) / rate
+	switch arrival {
+	case internal.ArrivalConstant:
+		return func() time.Duration { return time.Duration(mean) }, nil
+	case internal.ArrivalPoisson:
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		return func() time.Duration { return time.Duration(rng.ExpFloat64() * mean) }, nil
+	default:
+		return nil, fmt.Errorf("unknown arrival: %q", arrival)
+	}
+}
+
+// arrivals sends the intended start time of every op on the returned channel
+// until stop returns true. Sending blocks while all workers are busy, but the
+// schedule is not adjusted, so the latency of ops measured from their intended
+// start includes the time they spent queueing.
+func arrivals(next func() time.Duration, stop func() bool) <-chan time.Time {
+	ch := make(chan time.Time)
+	go func() {
+		defer close(ch)
+		for t := time.Now(); !stop(); t = t.Add(next()) {
+			time.Sleep(time.Until(t))
+			ch <- t
+		}
+	}()
+	return ch
+}
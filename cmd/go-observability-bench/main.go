@@ -3,13 +3,19 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
 
+	"github.com/felixge/go-observability-bench/internal"
+	"github.com/felixge/go-observability-bench/workload"
 	"gopkg.in/yaml.v3"
 )
 
-const usage = "usage: go-observability-bench <config> <outdir>"
+const usage = "usage: go-observability-bench <config> <outdir> | plan <config> | list-workloads | list-profiles"
 
 func main() {
 	if err := run(); err != nil {
@@ -20,12 +26,24 @@ func main() {
 
 func run() error {
 	var (
-		verboseF = flag.Bool("v", false, "Verbose output")
+		verboseF  = flag.Bool("v", false, "Verbose output")
+		resumeF   = flag.Bool("resume", false, "Resume the session in outdir instead of starting over")
+		parallelF = flag.Int("parallel", 1, "Number of runs to execute in parallel, each pinned to its own CPUs")
 	)
 	flag.Parse()
 
 	var runner interface{ Run() error }
 	switch arg0 := flag.Arg(0); arg0 {
+	case "list-workloads":
+		return listWorkloads(os.Stdout)
+	case "list-profiles":
+		return listProfiles(os.Stdout)
+	case "plan":
+		if flag.Arg(1) == "" {
+			return fmt.Errorf("error: no config (%s)", usage)
+		}
+		c := &Coordinator{Config: flag.Arg(1), Parallel: *parallelF}
+		return c.Plan(os.Stdout)
 	case "_run":
 		data, err := ioutil.ReadAll(os.Stdin)
 		if err != nil {
@@ -45,11 +63,54 @@ func run() error {
 		}
 
 		runner = &Coordinator{
-			Bin:     os.Args[0],
-			Config:  arg0,
-			Outdir:  arg1,
-			Verbose: *verboseF,
+			Bin:      os.Args[0],
+			Config:   arg0,
+			Outdir:   arg1,
+			Verbose:  *verboseF,
+			Resume:   *resumeF,
+			Parallel: *parallelF,
 		}
 	}
 	return runner.Run()
 }
+
+// listWorkloads prints the registered workloads and their args to w.
+func listWorkloads(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, info := range workload.Workloads() {
+		fmt.Fprintf(tw, "%s\t%s\n", info.Name, info.Description)
+		for _, arg := range info.Args {
+			def := ""
+			if arg.Default != "" {
+				def = fmt.Sprintf(" (default: %s)", arg.Default)
+			}
+			fmt.Fprintf(tw, "\t  %s %s: %s%s\n", arg.Name, arg.Type, arg.Description, def)
+		}
+	}
+	return tw.Flush()
+}
+
+// listProfiles prints the built-in profile sets and the profilers of their
+// profiles to w.
+func listProfiles(w io.Writer) error {
+	var names []string
+	for name := range internal.BuiltinProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	var config internal.Config
+	for _, name := range names {
+		config.Jobs = []internal.JobConfig{{Profile: internal.BuiltinProfiles[name]}}
+		if err := config.ResolveProfiles(); err != nil {
+			return err
+		}
+		var profiles []string
+		for _, p := range config.Jobs[0].Profile {
+			profiles = append(profiles, strings.Join(p.Profilers(), ","))
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", name, strings.Join(profiles, " | "))
+	}
+	return tw.Flush()
+}
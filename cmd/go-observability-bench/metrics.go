@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"runtime/metrics"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+// MetricsSampler periodically reads all runtime/metrics and writes them to
+// internal.MetricsFile when stopped. Samples are kept in memory until then to
+// avoid adding I/O to the measurement.
+type MetricsSampler struct {
+	Interval time.Duration
+	Outdir   string
+
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	raw     []metrics.Sample
+	prev    map[string]*metrics.Float64Histogram
+	samples []internal.MetricSample
+}
+
+// Start reads the histograms once to serve as the baseline of the first
+// sample, so the deltas only cover the time since Start, and starts
+// sampling.
+func (s *MetricsSampler) Start() {
+	s.stopCh = make(chan struct{})
+	s.doneCh = make(chan struct{})
+	descs := metrics.All()
+	s.raw = make([]metrics.Sample, len(descs))
+	for i, desc := range descs {
+		s.raw[i].Name = desc.Name
+	}
+	s.prev = map[string]*metrics.Float64Histogram{}
+	metrics.Read(s.raw)
+	for _, r := range s.raw {
+		if r.Value.Kind() == metrics.KindFloat64Histogram {
+			s.prev[r.Name] = copyHistogram(r.Value.Float64Histogram())
+		}
+	}
+	go s.sampleLoop()
+}
+
+// Stop takes a final sample and writes the timeline to disk.
+func (s *MetricsSampler) Stop() error {
+	close(s.stopCh)
+	<-s.doneCh
+	return internal.WriteMetrics(filepath.Join(s.Outdir, internal.MetricsFile), s.samples)
+}
+
+func (s *MetricsSampler) sampleLoop() {
+	defer close(s.doneCh)
+	tick := time.NewTicker(s.Interval)
+	defer tick.Stop()
+
+	for {
+		s.sample()
+		select {
+		case <-tick.C:
+		case <-s.stopCh:
+			s.sample()
+			return
+		}
+	}
+}
+
+func (s *MetricsSampler) sample() {
+	metrics.Read(s.raw)
+	now := time.Now()
+	for _, r := range s.raw {
+		sample := internal.MetricSample{Time: now, Name: r.Name}
+		switch r.Value.Kind() {
+		case metrics.KindUint64:
+			sample.Value = float64(r.Value.Uint64())
+		case metrics.KindFloat64:
+			sample.Value = r.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			h := r.Value.Float64Histogram()
+			sample.Count, sample.Max = histogramDelta(s.prev[r.Name], h)
+			s.prev[r.Name] = copyHistogram(h)
+		default:
+			continue
+		}
+		s.samples = append(s.samples, sample)
+	}
+}
+
+// copyHistogram returns a copy of h. metrics.Read reuses the histogram
+// memory, so histograms are copied before comparing them to the next sample.
+func copyHistogram(h *metrics.Float64Histogram) *metrics.Float64Histogram {
+	return &metrics.Float64Histogram{
+		Counts:  append([]uint64(nil), h.Counts...),
+		Buckets: h.Buckets,
+	}
+}
+
+// histogramDelta returns the number of values recorded by cur since prev and
+// the upper bound of the highest bucket they fall into, or its lower bound if
+// it's +Inf. A nil prev is treated as an empty histogram.
+func histogramDelta(prev, cur *metrics.Float64Histogram) (count uint64, max float64) {
+	for i, c := range cur.Counts {
+		if prev != nil && i < len(prev.Counts) {
+			c -= prev.Counts[i]
+		}
+		if c == 0 {
+			continue
+		}
+		count += c
+		if max = cur.Buckets[i+1]; math.IsInf(max, 1) {
+			max = cur.Buckets[i]
+		}
+	}
+	return count, max
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMetricsSamplerBaseline(t *testing.T) {
+	// The pauses of these GCs happen before Start and must not show up in
+	// the first sample.
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+	}
+	s := &MetricsSampler{Interval: time.Hour, Outdir: t.TempDir()}
+	s.Start()
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, sample := range s.samples {
+		if sample.Name == "/sched/pauses/total/gc:seconds" {
+			found = true
+			if sample.Count != 0 {
+				t.Errorf("got %d gc pauses in the sample at %s, want 0", sample.Count, sample.Time)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("no gc pause samples")
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal"
+	"golang.org/x/sys/unix"
+)
+
+// perfRescanInterval is how often perfCounters looks for threads that were
+// started after the counters were opened.
+const perfRescanInterval = 10 * time.Millisecond
+
+// perfCounter is one perf_event counter, opened for every thread of the
+// process.
+type perfCounter struct {
+	name   string
+	typ    uint32
+	config uint64
+	fds    []int
+}
+
+// perfCounters counts events for all threads of the process. The kernel only
+// folds the counts of inherited counters into their parent when a thread
+// exits, and the runtime never exits its threads, so instead of relying on
+// inherit the threads are rescanned periodically and counters are opened for
+// new ones.
+type perfCounters struct {
+	counters []*perfCounter
+	result   internal.PerfCounters
+
+	// threads and err are only accessed by rescanLoop until it's done.
+	threads map[int]bool
+	err     error
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+// startPerfCounters opens and enables the counters. Counters that can't be
+// opened are recorded as unavailable, an error is returned if none can be
+// opened.
+func startPerfCounters() (*perfCounters, error) {
+	tids, err := threadIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &perfCounters{threads: make(map[int]bool)}
+	var firstErr error
+	for _, c := range []*perfCounter{
+		{name: "instructions", typ: unix.PERF_TYPE_HARDWARE, config: unix.PERF_COUNT_HW_INSTRUCTIONS},
+		{name: "cycles", typ: unix.PERF_TYPE_HARDWARE, config: unix.PERF_COUNT_HW_CPU_CYCLES},
+		{name: "cache_misses", typ: unix.PERF_TYPE_HARDWARE, config: unix.PERF_COUNT_HW_CACHE_MISSES},
+		{name: "branch_misses", typ: unix.PERF_TYPE_HARDWARE, config: unix.PERF_COUNT_HW_BRANCH_MISSES},
+		{name: "task_clock", typ: unix.PERF_TYPE_SOFTWARE, config: unix.PERF_COUNT_SW_TASK_CLOCK},
+	} {
+		if err := c.openAll(tids); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			p.result.Unavailable = append(p.result.Unavailable, c.name)
+			continue
+		}
+		p.counters = append(p.counters, c)
+	}
+	if len(p.counters) == 0 {
+		return nil, firstErr
+	}
+
+	for _, c := range p.counters {
+		for _, fd := range c.fds {
+			if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_ENABLE, 0); err != nil {
+				p.close()
+				return nil, fmt.Errorf("perf_event enable %s: %w", c.name, err)
+			}
+		}
+	}
+	for _, tid := range tids {
+		p.threads[tid] = true
+	}
+	p.stopCh = make(chan struct{})
+	p.doneCh = make(chan struct{})
+	go p.rescanLoop()
+	return p, nil
+}
+
+// openAll opens disabled counters for tids, so that all of them can be
+// enabled at the same time.
+func (c *perfCounter) openAll(tids []int) error {
+	for _, tid := range tids {
+		err := c.open(tid, true)
+		if errors.Is(err, unix.ESRCH) {
+			// The thread exited since it was listed.
+			continue
+		} else if err != nil {
+			c.close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *perfCounter) open(tid int, disabled bool) error {
+	attr := &unix.PerfEventAttr{
+		Type:        c.typ,
+		Config:      c.config,
+		Size:        uint32(binary.Size(unix.PerfEventAttr{})),
+		Read_format: unix.PERF_FORMAT_TOTAL_TIME_ENABLED | unix.PERF_FORMAT_TOTAL_TIME_RUNNING,
+		// Excluding the kernel allows counting with the default
+		// perf_event_paranoid setting of most distributions.
+		Bits: unix.PerfBitExcludeKernel | unix.PerfBitExcludeHv,
+	}
+	if disabled {
+		attr.Bits |= unix.PerfBitDisabled
+	}
+	fd, err := unix.PerfEventOpen(attr, tid, -1, -1, unix.PERF_FLAG_FD_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("perf_event_open %s: %w", c.name, err)
+	}
+	c.fds = append(c.fds, fd)
+	return nil
+}
+
+// rescanLoop opens enabled counters for threads started after
+// startPerfCounters until Stop is called.
+func (p *perfCounters) rescanLoop() {
+	defer close(p.doneCh)
+	tick := time.NewTicker(perfRescanInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-tick.C:
+			p.rescan()
+		}
+	}
+}
+
+func (p *perfCounters) rescan() {
+	tids, err := threadIDs()
+	if err != nil {
+		if p.err == nil {
+			p.err = err
+		}
+		return
+	}
+	for _, tid := range tids {
+		if p.threads[tid] {
+			continue
+		}
+		p.threads[tid] = true
+		for _, c := range p.counters {
+			err := c.open(tid, false)
+			if err != nil && !errors.Is(err, unix.ESRCH) && p.err == nil {
+				p.err = err
+			}
+		}
+	}
+}
+
+// read returns the sum of the counter for all threads, scaled up for the time
+// the counter wasn't running because of multiplexing.
+func (c *perfCounter) read() (uint64, error) {
+	var sum uint64
+	buf := make([]byte, 24)
+	for _, fd := range c.fds {
+		if _, err := unix.Read(fd, buf); err != nil {
+			return 0, fmt.Errorf("perf_event read %s: %w", c.name, err)
+		}
+		value := binary.LittleEndian.Uint64(buf[0:])
+		enabled := binary.LittleEndian.Uint64(buf[8:])
+		running := binary.LittleEndian.Uint64(buf[16:])
+		if running > 0 && running < enabled {
+			value = uint64(float64(value) * float64(enabled) / float64(running))
+		}
+		sum += value
+	}
+	return sum, nil
+}
+
+func (c *perfCounter) close() {
+	for _, fd := range c.fds {
+		unix.Close(fd)
+	}
+	c.fds = nil
+}
+
+// Stop disables and closes the counters and returns their values.
+func (p *perfCounters) Stop() internal.PerfCounters {
+	close(p.stopCh)
+	<-p.doneCh
+	for _, c := range p.counters {
+		for _, fd := range c.fds {
+			unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_DISABLE, 0)
+		}
+	}
+	defer p.close()
+
+	if p.err != nil {
+		p.result.Error = p.err.Error()
+		return p.result
+	}
+	for _, c := range p.counters {
+		value, err := c.read()
+		if err != nil {
+			p.result.Error = err.Error()
+			return p.result
+		}
+		switch c.name {
+		case "instructions":
+			p.result.Instructions = value
+		case "cycles":
+			p.result.Cycles = value
+		case "cache_misses":
+			p.result.CacheMisses = value
+		case "branch_misses":
+			p.result.BranchMisses = value
+		case "task_clock":
+			p.result.TaskClock = time.Duration(value)
+		}
+	}
+	return p.result
+}
+
+func (p *perfCounters) close() {
+	for _, c := range p.counters {
+		c.close()
+	}
+}
+
+// threadIDs returns the ids of all threads of the process.
+func threadIDs() ([]int, error) {
+	entries, err := ioutil.ReadDir("/proc/self/task")
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		tid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		tids = append(tids, tid)
+	}
+	return tids, nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+type perfCounters struct{}
+
+func startPerfCounters() (*perfCounters, error) {
+	return nil, errors.New("perf counters are only supported on linux")
+}
+
+func (p *perfCounters) Stop() internal.PerfCounters {
+	return internal.PerfCounters{}
+}
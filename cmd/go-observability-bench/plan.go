@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal"
+	"github.com/felixge/go-observability-bench/workload"
+	"gopkg.in/yaml.v3"
+)
+
+// readConfig reads and validates the config file of c. It returns the
+// config and the raw file contents, or an error listing all problems found.
+func (c *Coordinator) readConfig() (internal.Config, []byte, error) {
+	config, err := internal.ReadConfig(c.Config)
+	if err != nil {
+		return config, nil, err
+	}
+	data, err := ioutil.ReadFile(c.Config)
+	if err != nil {
+		return config, nil, err
+	}
+
+	errs, err := internal.CheckConfigKeys(data)
+	if err != nil {
+		return config, nil, err
+	}
+	errs = append(errs, config.Validate()...)
+	errs = append(errs, validateWorkloads(config)...)
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = "  " + e.Error()
+		}
+		return config, nil, fmt.Errorf("invalid config %s:\n%s", c.Config, strings.Join(msgs, "\n"))
+	}
+	return config, data, nil
+}
+
+// validateWorkloads checks that the workloads of every job exist, that
+// their args can be decoded and that they support the tracing of the job.
+// The args of a job are shared by its workloads, so an arg only needs to be
+// accepted by one of them, while WorkloadArgs must be accepted by their
+// workload.
+func validateWorkloads(config internal.Config) []*internal.ConfigError {
+	var errs []*internal.ConfigError
+	for i, j := range config.Jobs {
+		path := fmt.Sprintf("jobs[%d]", i)
+		var names []string
+		seen := map[string]bool{}
+		for _, e := range j.Matrix() {
+			if !seen[e.Workload] {
+				seen[e.Workload] = true
+				names = append(names, e.Workload)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+
+		var infos []workload.Info
+		argNames := map[string]map[string]bool{}
+		allArgNames := map[string]bool{}
+		for _, name := range names {
+			info, ok := workload.Lookup(name)
+			if !ok {
+				errs = append(errs, &internal.ConfigError{Path: path + ".workload", Msg: fmt.Sprintf("unknown workload %q, see list-workloads", name)})
+				continue
+			}
+			infos = append(infos, info)
+			argNames[name] = map[string]bool{}
+			for _, arg := range info.Args {
+				argNames[name][arg.Name] = true
+				allArgNames[arg.Name] = true
+			}
+		}
+		// Unknown workloads were reported above, their args are unknown.
+		known := len(infos) == len(names)
+
+		of := "workload " + names[0]
+		if len(names) > 1 {
+			of = "any of the workloads " + strings.Join(names, ", ")
+		}
+		for k := range j.Args {
+			apath := fmt.Sprintf("%s.args[%d]", path, k)
+			if known {
+				errs = append(errs, checkArgNames(&j.Args[k], apath, allArgNames, of)...)
+			}
+		}
+		var overridden []string
+		for name := range j.WorkloadArgs {
+			overridden = append(overridden, name)
+		}
+		sort.Strings(overridden)
+		for _, name := range overridden {
+			apath := fmt.Sprintf("%s.workload_args.%s", path, name)
+			args := j.WorkloadArgs[name]
+			if !seen[name] {
+				errs = append(errs, &internal.ConfigError{Path: apath, Line: args.Line, Msg: fmt.Sprintf("%q is not a workload of the job", name)})
+			} else if argNames[name] != nil {
+				errs = append(errs, checkArgNames(&args, apath, argNames[name], "workload "+name)...)
+			}
+		}
+
+		for _, info := range infos {
+			for k, args := range j.ArgsFor(info.Name) {
+				err := args.Decode(info.Factory())
+				if te, ok := err.(*yaml.TypeError); ok {
+					err = fmt.Errorf("%s", strings.Join(te.Errors, "; "))
+				}
+				if err != nil {
+					errs = append(errs, &internal.ConfigError{Path: fmt.Sprintf("%s.args[%d]", path, k), Msg: fmt.Sprintf("invalid args for workload %s: %s", info.Name, err)})
+				}
+			}
+			tw, ok := info.Factory().(workload.Traceable)
+			if !ok {
+				continue
+			}
+			checked := map[string]bool{}
+			for _, e := range j.Matrix() {
+				if e.Workload != info.Name || e.Tracing == "" || e.Tracing == internal.TracingNone || checked[e.Tracing] {
+					continue
+				}
+				checked[e.Tracing] = true
+				if err := tw.Trace(e.Tracing); err != nil {
+					errs = append(errs, &internal.ConfigError{Path: path + ".tracing", Msg: fmt.Sprintf("workload %s: %s", info.Name, err)})
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// checkArgNames returns an error if args is not a mapping or for every key
+// of it that is not in names. of describes the workloads the names belong
+// to.
+func checkArgNames(args *yaml.Node, path string, names map[string]bool, of string) []*internal.ConfigError {
+	if args.Kind == yaml.AliasNode {
+		args = args.Alias
+	}
+	if args.Kind != yaml.MappingNode {
+		return []*internal.ConfigError{{Path: path, Line: args.Line, Msg: "args must be a mapping"}}
+	}
+	var errs []*internal.ConfigError
+	for n := 0; n+1 < len(args.Content); n += 2 {
+		if key := args.Content[n]; !names[key.Value] {
+			errs = append(errs, &internal.ConfigError{Path: path, Line: key.Line, Msg: fmt.Sprintf("%q is not an arg of %s", key.Value, of)})
+		}
+	}
+	return errs
+}
+
+// Plan validates the config of c and writes the runs it would execute to w
+// without executing them.
+func (c *Coordinator) Plan(w io.Writer) error {
+	config, _, err := c.readConfig()
+	if err != nil {
+		return err
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	runs, err := c.runConfigs(config)
+	if err != nil {
+		return err
+	}
+	if runs, err = schedule(runs, config.Schedule, seed); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "#\tNAME\tWORKLOAD\tCONCURRENCY\tDURATION\tINSTRUMENTATION\n")
+	var totalDuration time.Duration
+	for _, run := range runs {
+		duration := run.Warmup + run.Duration + run.Cooldown
+		totalDuration += duration
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", run.Order, run.Name, run.Workload, run.Concurrency, duration, strings.Join(run.Instrumentation(), "+"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	parallel := c.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	fmt.Fprintf(w, "\n%d runs, expected duration: %s, schedule: %s", len(runs), totalDuration/time.Duration(parallel), config.Schedule)
+	if config.Schedule == internal.ScheduleRandom {
+		fmt.Fprintf(w, " (seed: %d)", seed)
+	}
+	if parallel > 1 {
+		fmt.Fprintf(w, ", parallel: %d", parallel)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		// want is the output of Plan, or the lines of the error if the
+		// config is invalid.
+		want string
+		err  bool
+	}{
+		{
+			name: "valid",
+			config: `
+repeat: 2
+schedule: round-robin
+jobs:
+  - name: "${workload}/${concurrency}/${profilers}/${iteration}"
+    workload: [cpuratio, allocsize]
+    concurrency: [1, 4]
+    duration: [1s]
+    profile: [{}, cpu]
+    exclude: [{workload: allocsize, concurrency: 4}]
+    args: [{}]
+    workload_args:
+      cpuratio: {iterations: 1000}
+`,
+			want: `
+#   NAME                WORKLOAD   CONCURRENCY  DURATION  INSTRUMENTATION
+0   cpuratio/1/none/0   cpuratio   1            1s        none
+1   cpuratio/1/cpu/0    cpuratio   1            1s        cpu
+2   cpuratio/4/none/0   cpuratio   4            1s        none
+3   cpuratio/4/cpu/0    cpuratio   4            1s        cpu
+4   allocsize/1/none/0  allocsize  1            1s        none
+5   allocsize/1/cpu/0   allocsize  1            1s        cpu
+6   cpuratio/1/cpu/1    cpuratio   1            1s        cpu
+7   cpuratio/1/none/1   cpuratio   1            1s        none
+8   cpuratio/4/cpu/1    cpuratio   4            1s        cpu
+9   cpuratio/4/none/1   cpuratio   4            1s        none
+10  allocsize/1/cpu/1   allocsize  1            1s        cpu
+11  allocsize/1/none/1  allocsize  1            1s        none
+
+12 runs, expected duration: 12s, schedule: round-robin
+`,
+		},
+		{
+			name: "unknown keys and bad values",
+			config: `
+jobs:
+  - name: a
+    workload: [cpuratio]
+    concurrency: [0]
+    duration: [1s]
+    profile: [{datadog: true, cpu: true}]
+    args: [{}]
+    sheduel: random
+`,
+			want: `
+invalid config config.yaml:
+  line 9: jobs[0]: unknown key "sheduel"
+  jobs[0].concurrency: must be >= 1, got 0
+  jobs[0].profile[0].cpu: can't be combined with datadog
+`,
+			err: true,
+		},
+		{
+			name: "bad workloads and args",
+			config: `
+jobs:
+  - name: a
+    workload: [cpuratio, allocsize, nope]
+    concurrency: [1]
+    duration: [1s]
+    args: [{iterations: 10, allocs: 10, bogus: 1}]
+    workload_args:
+      json: {json_file: x}
+`,
+			want: `
+invalid config config.yaml:
+  jobs[0].workload: unknown workload "nope", see list-workloads
+  line 9: jobs[0].workload_args.json: "json" is not a workload of the job
+`,
+			err: true,
+		},
+		{
+			name: "tracing without an integration",
+			config: `
+jobs:
+  - name: a
+    workload: [sql, http]
+    concurrency: [1]
+    duration: [1s]
+    tracing: [none, datadog, otel]
+    args: [{}]
+`,
+			want: `
+invalid config config.yaml:
+  jobs[0].tracing: workload sql: tracing "otel" has no database/sql integration
+`,
+			err: true,
+		},
+		{
+			name: "args of other workloads",
+			config: `
+jobs:
+  - name: a
+    workload: [cpuratio, allocsize]
+    concurrency: [1]
+    duration: [1s]
+    args: [{iterations: many, bogus: 1}]
+    workload_args:
+      allocsize: {iterations: 10}
+`,
+			want: `
+invalid config config.yaml:
+  line 7: jobs[0].args[0]: "bogus" is not an arg of any of the workloads cpuratio, allocsize
+  line 9: jobs[0].workload_args.allocsize: "iterations" is not an arg of workload allocsize
+  jobs[0].args[0]: invalid args for workload cpuratio: line 7: cannot unmarshal !!str ` + "`many`" + ` into int
+`,
+			err: true,
+		},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		c := &Coordinator{Config: path}
+		err := c.Plan(&buf)
+		got := buf.String()
+		if err != nil {
+			got = strings.Replace(err.Error(), path, "config.yaml", 1) + "\n"
+		}
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.err)
+		}
+		if want := strings.TrimPrefix(tt.want, "\n"); got != want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.name, got, want)
+		}
+	}
+}
@@ -4,8 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
@@ -13,25 +11,34 @@ import (
 	"time"
 
 	"github.com/felixge/go-observability-bench/internal"
+	ddprofiler "gopkg.in/DataDog/dd-trace-go.v1/profiler"
 )
 
 type Profiler struct {
 	internal.ProfileConfig
 	Duration time.Duration
-	Outdir   string
+	Sink     profileSink
 
 	doneCh   chan struct{}
 	profiles []internal.RunProfile
 	bufs     map[string]*bytes.Buffer
-	profs    map[string]*internal.RunProfile
+	// profs holds the index of the latest profile of every kind in
+	// profiles. Pointers into profiles would be invalidated by append.
+	profs map[string]int
+	// agent receives the uploads of the datadog profiler.
+	agent *fakeAgent
 }
 
 type profiler struct {
 	Kind    string
 	Enabled func(internal.ProfileConfig) bool
-	Init    func(internal.ProfileConfig)
+	Init    func(*Profiler) error
 	Start   func(io.Writer) error
-	Stop    func(io.Writer) error
+	Stop    func(*Profiler, io.Writer) error
+	// Close is called once right before the last Stop, it's optional. It
+	// lets continuous profilers flush their final period so that the last
+	// Stop can collect it.
+	Close func(*Profiler) error
 }
 
 var profilers = []profiler{
@@ -41,7 +48,7 @@ var profilers = []profiler{
 		Start: func(w io.Writer) error {
 			return pprof.StartCPUProfile(w)
 		},
-		Stop: func(_ io.Writer) error {
+		Stop: func(_ *Profiler, _ io.Writer) error {
 			pprof.StopCPUProfile()
 			return nil
 		},
@@ -50,12 +57,13 @@ var profilers = []profiler{
 	{
 		Kind:    "mem.pprof",
 		Enabled: func(c internal.ProfileConfig) bool { return c.Mem },
-		Init: func(c internal.ProfileConfig) {
-			if c.MemRate != 0 {
-				runtime.MemProfileRate = c.MemRate
+		Init: func(p *Profiler) error {
+			if p.MemRate != 0 {
+				runtime.MemProfileRate = p.MemRate
 			}
+			return nil
 		},
-		Stop: func(w io.Writer) error {
+		Stop: func(_ *Profiler, w io.Writer) error {
 			return pprof.Lookup("allocs").WriteTo(w, 0)
 		},
 	},
@@ -63,12 +71,13 @@ var profilers = []profiler{
 	{
 		Kind:    "block.pprof",
 		Enabled: func(c internal.ProfileConfig) bool { return c.Block },
-		Init: func(c internal.ProfileConfig) {
-			if c.BlockRate != 0 {
-				runtime.SetBlockProfileRate(c.BlockRate)
+		Init: func(p *Profiler) error {
+			if p.BlockRate != 0 {
+				runtime.SetBlockProfileRate(p.BlockRate)
 			}
+			return nil
 		},
-		Stop: func(w io.Writer) error {
+		Stop: func(_ *Profiler, w io.Writer) error {
 			return pprof.Lookup("block").WriteTo(w, 0)
 		},
 	},
@@ -76,20 +85,21 @@ var profilers = []profiler{
 	{
 		Kind:    "mutex.pprof",
 		Enabled: func(c internal.ProfileConfig) bool { return c.Mutex },
-		Init: func(c internal.ProfileConfig) {
-			if c.MutexRate != 0 {
-				runtime.SetMutexProfileFraction(c.MutexRate)
+		Init: func(p *Profiler) error {
+			if p.MutexRate != 0 {
+				runtime.SetMutexProfileFraction(p.MutexRate)
 			}
+			return nil
 		},
-		Stop: func(w io.Writer) error {
+		Stop: func(_ *Profiler, w io.Writer) error {
 			return pprof.Lookup("mutex").WriteTo(w, 0)
 		},
 	},
 
 	{
 		Kind:    "goroutine.pprof",
-		Enabled: func(c internal.ProfileConfig) bool { return c.Mutex },
-		Stop: func(w io.Writer) error {
+		Enabled: func(c internal.ProfileConfig) bool { return c.Goroutine },
+		Stop: func(_ *Profiler, w io.Writer) error {
 			return pprof.Lookup("goroutine").WriteTo(w, 0)
 		},
 	},
@@ -100,17 +110,44 @@ var profilers = []profiler{
 		Start: func(w io.Writer) error {
 			return trace.Start(w)
 		},
-		Stop: func(_ io.Writer) error {
+		Stop: func(_ *Profiler, _ io.Writer) error {
 			trace.Stop()
 			return nil
 		},
 	},
+
+	{
+		Kind:    "datadog.multipart",
+		Enabled: func(c internal.ProfileConfig) bool { return c.Datadog },
+		Init: func(p *Profiler) error {
+			p.agent = newFakeAgent(true)
+			return ddprofiler.Start(
+				ddprofiler.WithAgentAddr(p.agent.Addr()),
+				ddprofiler.WithService("go-observability-bench"),
+				ddprofiler.WithPeriod(p.Period),
+				ddprofiler.CPUDuration(p.DatadogCPUDuration),
+			)
+		},
+		// The datadog profiler runs continuously on its own schedule, so Stop
+		// only collects the uploads the fake agent received during the period.
+		Stop: func(p *Profiler, w io.Writer) error {
+			_, err := p.agent.WriteTo(w)
+			return err
+		},
+		// Stopping the profiler waits for in-flight uploads, so they end up
+		// in the last period instead of being lost.
+		Close: func(p *Profiler) error {
+			ddprofiler.Stop()
+			p.agent.Close()
+			return nil
+		},
+	},
 }
 
 func (p *Profiler) Start() {
 	p.doneCh = make(chan struct{})
 	p.bufs = make(map[string]*bytes.Buffer)
-	p.profs = make(map[string]*internal.RunProfile)
+	p.profs = make(map[string]int)
 
 	if enabled := p.startProfiles(0); enabled == 0 {
 		close(p.doneCh)
@@ -127,8 +164,9 @@ func (p *Profiler) startProfiles(iteration int) int {
 		}
 		enabled++
 
+		var startErr error
 		if iteration == 0 && prof.Init != nil {
-			prof.Init(p.ProfileConfig)
+			startErr = prof.Init(p)
 		}
 
 		var buf *bytes.Buffer
@@ -138,8 +176,7 @@ func (p *Profiler) startProfiles(iteration int) int {
 			buf.Reset() // TODO: lowers allocs, but increases max(heap)
 		}
 		start := time.Now()
-		var startErr error
-		if prof.Start != nil {
+		if prof.Start != nil && startErr == nil {
 			startErr = prof.Start(buf)
 		}
 
@@ -149,54 +186,61 @@ func (p *Profiler) startProfiles(iteration int) int {
 			Error: errStr(startErr),
 		})
 		p.bufs[prof.Kind] = buf
-		p.profs[prof.Kind] = &p.profiles[len(p.profiles)-1]
+		p.profs[prof.Kind] = len(p.profiles) - 1
 	}
 	return enabled
 }
 
-func (p *Profiler) stopProfiles(iteration int) {
+func (p *Profiler) stopProfiles(iteration int, last bool) {
 	for _, prof := range profilers {
 		if !prof.Enabled(p.ProfileConfig) {
 			continue
 		}
 
-		record := p.profs[prof.Kind]
+		record := &p.profiles[p.profs[prof.Kind]]
 		buf := p.bufs[prof.Kind]
 		stop := time.Now()
 		record.ProfileDuration = stop.Sub(record.Start)
+		if last && prof.Close != nil {
+			if err := prof.Close(p); err != nil && record.Error == "" {
+				record.Error = errStr(err)
+			}
+		}
 		if prof.Stop != nil {
-			if err := prof.Stop(buf); err != nil && record.Error == "" {
+			if err := prof.Stop(p, buf); err != nil && record.Error == "" {
 				record.Error = errStr(err)
 			}
 		}
 		record.StopDuration = time.Since(stop)
 		kind := strings.Split(prof.Kind, ".")
-		record.File = fmt.Sprintf("%s.%d.%s", kind[0], iteration, kind[1])
-		profPath := filepath.Join(p.Outdir, record.File)
-		writErr := ioutil.WriteFile(profPath, buf.Bytes(), 0644)
-		if writErr != nil && record.Error == "" {
-			record.Error = errStr(writErr)
+		name := fmt.Sprintf("%s.%d.%s", kind[0], iteration, kind[1])
+		record.Bytes = int64(buf.Len())
+		sinkStart := time.Now()
+		file, sinkErr := p.Sink.Write(name, buf.Bytes())
+		record.SinkDuration = time.Since(sinkStart)
+		record.File = file
+		if sinkErr != nil && record.Error == "" {
+			record.Error = errStr(sinkErr)
 		}
 	}
 }
 
-func (p *Profiler) Done() ([]internal.RunProfile, bool) {
-	select {
-	case <-p.doneCh:
-		return p.profiles, true
-	default:
-		return nil, false
-	}
+// Wait blocks until the profiler has finished its last period and returns
+// the recorded profiles.
+func (p *Profiler) Wait() []internal.RunProfile {
+	<-p.doneCh
+	return p.profiles
 }
 
 func (p *Profiler) profileLoop() {
 	defer close(p.doneCh)
 	loopStart := time.Now()
 	tick := time.NewTicker(p.Period)
-	for i := 0; ; {
+	for i := 0; ; i++ {
 		<-tick.C
-		p.stopProfiles(i)
-		if time.Since(loopStart) >= p.Duration {
+		last := time.Since(loopStart) >= p.Duration
+		p.stopProfiles(i, last)
+		if last {
 			return
 		}
 		p.startProfiles(i + 1)
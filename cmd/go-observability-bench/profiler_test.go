@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+func runProfiler(t *testing.T, c internal.ProfileConfig, d time.Duration) []internal.RunProfile {
+	t.Helper()
+	p := &Profiler{
+		ProfileConfig: c,
+		Duration:      d,
+		Sink:          diskSink{dir: t.TempDir()},
+	}
+	p.Start()
+	return p.Wait()
+}
+
+func TestProfilerIterations(t *testing.T) {
+	c := internal.ProfileConfig{Mem: true, Period: 20 * time.Millisecond}
+	profiles := runProfiler(t, c, 70*time.Millisecond)
+	if len(profiles) < 2 {
+		t.Fatalf("got %d profiles, want at least 2", len(profiles))
+	}
+	for i, p := range profiles {
+		if want := fmt.Sprintf("mem.%d.pprof", i); p.File != want {
+			t.Errorf("profile %d: got file %q, want %q", i, p.File, want)
+		}
+	}
+}
+
+func TestProfilerRecords(t *testing.T) {
+	// Several kinds per period make appends to the profiles slice grow it
+	// while earlier records of the same period are still being filled in.
+	c := internal.ProfileConfig{Mem: true, Block: true, Mutex: true, Period: 20 * time.Millisecond}
+	profiles := runProfiler(t, c, 70*time.Millisecond)
+	for i, p := range profiles {
+		if p.File == "" || p.ProfileDuration == 0 {
+			t.Errorf("profile %d (%s): incomplete record %+v", i, p.Kind, p)
+		}
+	}
+}
+
+func TestProfilersEnabled(t *testing.T) {
+	tests := []struct {
+		config internal.ProfileConfig
+		want   []string
+	}{
+		{internal.ProfileConfig{}, nil},
+		{internal.ProfileConfig{CPU: true}, []string{"cpu.pprof"}},
+		{internal.ProfileConfig{Mem: true}, []string{"mem.pprof"}},
+		{internal.ProfileConfig{Block: true}, []string{"block.pprof"}},
+		{internal.ProfileConfig{Mutex: true}, []string{"mutex.pprof"}},
+		{internal.ProfileConfig{Goroutine: true}, []string{"goroutine.pprof"}},
+		{internal.ProfileConfig{Trace: true}, []string{"trace.out"}},
+		{internal.ProfileConfig{Datadog: true}, []string{"datadog.multipart"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, prof := range profilers {
+			if prof.Enabled(tt.config) {
+				got = append(got, prof.Kind)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%+v: got %v, want %v", tt.config, got, tt.want)
+		}
+	}
+}
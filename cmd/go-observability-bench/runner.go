@@ -2,12 +2,12 @@ package main
 
 import (
 	"encoding/csv"
-	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/felixge/go-observability-bench/internal"
@@ -26,6 +26,17 @@ type RunMeta struct {
 
 func (r *Runner) Run() error {
 	r.Start = time.Now()
+	if len(r.RunConfig.CPUs) > 0 {
+		if err := setAffinity(r.RunConfig.CPUs); err != nil {
+			return err
+		}
+		runtime.GOMAXPROCS(len(r.RunConfig.CPUs))
+		cpus, err := availableCPUs()
+		if err != nil {
+			return err
+		}
+		r.Env.CPUs = cpus
+	}
 	r.Env.GoVersion = runtime.Version()
 	r.Env.GoOS = runtime.GOOS
 	r.Env.GoArch = runtime.GOARCH
@@ -36,88 +47,193 @@ func (r *Runner) Run() error {
 	if err != nil {
 		return err
 	}
+	tracer, err := NewTracer(r.Tracing, r.Workload)
+	if err != nil {
+		return err
+	}
+	run := w.Run
+	if tracer != nil {
+		if tw, ok := w.(workload.Traceable); ok {
+			if err := tw.Trace(r.Tracing); err != nil {
+				return err
+			}
+		}
+		run = tracer.Wrap(run)
+	}
+	var next func() time.Duration
+	if r.Rate > 0 {
+		if next, err = interarrival(r.Rate, r.Arrival); err != nil {
+			return err
+		}
+	}
 	if err := w.Setup(); err != nil {
 		return err
 	}
 
-	r.BeforeRusage, err = getRusage()
+	sink, err := newProfileSink(r.Profile.Sink, r.Outdir)
 	if err != nil {
 		return err
 	}
-	runtime.ReadMemStats(&r.BeforeMemStats)
-
+	defer sink.Close()
 	prof := &Profiler{
 		ProfileConfig: r.Profile,
 		Duration:      r.RunConfig.Duration,
-		Outdir:        r.Outdir,
+		Sink:          sink,
 	}
-	prof.Start()
 
-	durationOver := closeAfter(r.RunConfig.Duration)
+	// Ops are tagged with the phase of the run they were started in, only
+	// ops without a phase are measured.
+	var phase atomic.Value
+	if r.Warmup > 0 {
+		phase.Store(internal.PhaseWarmup)
+	} else {
+		phase.Store("")
+	}
+	stopCh := make(chan struct{})
+	stop := func() bool {
+		select {
+		case <-stopCh:
+			return true
+		default:
+			return false
+		}
+	}
 
-	workerDone := make(chan []internal.RunOp)
-	for i := 0; i < r.Concurrency; i++ {
+	// In open-loop mode, ops are started at their intended start time by
+	// the next idle worker, otherwise every worker runs ops back to back.
+	var starts <-chan time.Time
+	if next != nil {
+		starts = arrivals(next, stop)
+	}
+
+	// With r.Histogram enabled, every worker records the latency of its ops
+	// into a histogram instead of keeping them.
+	var hist *internal.Histogram
+	if r.Histogram > 0 {
+		if hist, err = internal.NewHistogram(r.Histogram); err != nil {
+			return err
+		}
+	}
+
+	workerDone := make(chan workerResult)
+	for worker := 0; worker < r.Concurrency; worker++ {
 		go func() {
-			var ops []internal.RunOp
-			defer func() { workerDone <- ops }()
+			res := workerResult{worker: worker}
+			if hist != nil {
+				res.hist, _ = internal.NewHistogram(hist.Digits)
+			}
+			defer func() { workerDone <- res }()
 
 			for {
 				start := time.Now()
-				err := w.Run()
+				if starts != nil {
+					var ok bool
+					if start, ok = <-starts; !ok {
+						return
+					}
+				}
+				opPhase := phase.Load().(string)
+				err := run()
 				dt := time.Since(start)
 
-				op := internal.RunOp{
-					Start:    start,
-					Duration: dt,
-					Error:    errStr(err),
-				}
-				ops = append(ops, op)
-				select {
-				case <-durationOver:
-					if _, done := prof.Done(); done {
-						return
+				if res.hist != nil {
+					if opPhase == "" {
+						res.hist.Record(dt)
+						if err != nil {
+							res.hist.Errors++
+						}
 					}
-				default:
-					continue
+				} else {
+					op := internal.RunOp{
+						Start:    start,
+						Duration: dt,
+						Error:    errStr(err),
+						Phase:    opPhase,
+						Worker:   worker,
+					}
+					res.ops = append(res.ops, op)
+				}
+				if starts == nil && stop() {
+					return
 				}
 			}
 		}()
 	}
 
-	var allOps []internal.RunOp
-	for i := 0; i < r.Concurrency; i++ {
-		ops := <-workerDone
-		allOps = append(allOps, ops...)
-	}
-	r.RunResult.Duration = time.Since(r.Start)
-
-	csvFile, err := os.Create(filepath.Join(r.Outdir, "ops.csv"))
+	time.Sleep(r.Warmup)
+	phase.Store("")
+	measureStart := time.Now()
+	r.BeforeRusage, err = getRusage()
 	if err != nil {
 		return err
 	}
-	defer csvFile.Close()
-	cw := csv.NewWriter(csvFile)
-	cw.Write([]string{"start", "duration", "error"})
-	for _, op := range allOps {
-		cw.Write(op.ToRecord())
+	runtime.ReadMemStats(&r.BeforeMemStats)
+	var sampler *MetricsSampler
+	if r.MetricsInterval > 0 {
+		sampler = &MetricsSampler{Interval: r.MetricsInterval, Outdir: r.Outdir}
+		sampler.Start()
 	}
-	cw.Flush()
-	if err := cw.Error(); err != nil {
-		return err
+	var perf *perfCounters
+	if r.RunConfig.PerfCounters {
+		if perf, err = startPerfCounters(); err != nil {
+			r.RunResult.PerfCounters = &internal.PerfCounters{Error: err.Error()}
+		}
 	}
+	prof.Start()
 
-	if profiles, done := prof.Done(); !done {
-		return errors.New("bug: workers finished but profiler didn't")
-	} else {
-		r.Profiles = profiles
+	time.Sleep(r.RunConfig.Duration)
+	r.Profiles = prof.Wait()
+	if perf != nil {
+		counters := perf.Stop()
+		r.RunResult.PerfCounters = &counters
+	}
+	if sampler != nil {
+		if err := sampler.Stop(); err != nil {
+			return err
+		}
 	}
-
 	r.AfterRusage, err = getRusage()
 	if err != nil {
 		return err
 	}
 	runtime.ReadMemStats(&r.AfterMemStats)
 
+	phase.Store(internal.PhaseCooldown)
+	// Stopping the profiler, perf counters and sampler takes time, so the
+	// measured window is longer than the configured duration.
+	measured := time.Since(measureStart)
+	time.Sleep(r.Cooldown)
+	close(stopCh)
+
+	var allOps []internal.RunOp
+	r.Stats.Workers = make([]internal.WorkerStats, r.Concurrency)
+	for i := 0; i < r.Concurrency; i++ {
+		res := <-workerDone
+		allOps = append(allOps, res.ops...)
+		r.Stats.Workers[res.worker] = res.stats(measured)
+		if hist != nil {
+			if err := hist.Merge(res.hist); err != nil {
+				return err
+			}
+		}
+	}
+	r.Stats.Fairness = internal.Fairness(r.Stats.Workers)
+	r.RunResult.Duration = time.Since(r.Start)
+
+	if tracer != nil {
+		if r.TraceAgent, err = tracer.Stop(); err != nil {
+			return err
+		}
+	}
+
+	if hist != nil {
+		if err := hist.WriteFile(filepath.Join(r.Outdir, internal.HistogramFile)); err != nil {
+			return err
+		}
+	} else if err := writeOps(filepath.Join(r.Outdir, "ops.csv"), allOps); err != nil {
+		return err
+	}
+
 	data, err := yaml.Marshal(r)
 	if err != nil {
 		return err
@@ -126,6 +242,62 @@ func (r *Runner) Run() error {
 	return nil
 }
 
+type workerResult struct {
+	worker int
+	ops    []internal.RunOp
+	hist   *internal.Histogram
+}
+
+// stats returns the stats of the measured ops of the worker. The throughput
+// is relative to the measured window of the run, from the end of the warmup
+// to the start of the cooldown, during which the measured ops were started.
+func (res *workerResult) stats(window time.Duration) internal.WorkerStats {
+	s := internal.WorkerStats{Worker: res.worker}
+	if res.hist != nil {
+		s.OpsCount = res.hist.Count
+		s.AvgDuration = res.hist.Mean()
+		s.MaxDuration = res.hist.Max
+		s.Errors = res.hist.Errors
+	} else {
+		var total time.Duration
+		for _, op := range res.ops {
+			if !op.Measured() {
+				continue
+			}
+			s.OpsCount++
+			total += op.Duration
+			if op.Duration > s.MaxDuration {
+				s.MaxDuration = op.Duration
+			}
+			if op.Error != "" {
+				s.Errors++
+			}
+		}
+		if s.OpsCount > 0 {
+			s.AvgDuration = total / time.Duration(s.OpsCount)
+		}
+	}
+	if window > 0 {
+		s.OpsPerSecond = float64(s.OpsCount) / window.Seconds()
+	}
+	return s
+}
+
+func writeOps(path string, ops []internal.RunOp) error {
+	csvFile, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+	cw := csv.NewWriter(csvFile)
+	cw.Write([]string{"start", "duration", "error", "phase", "worker"})
+	for _, op := range ops {
+		cw.Write(op.ToRecord())
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
 func ReadOps(path string) ([]internal.RunOp, error) {
 	file, err := os.Open(path)
 	if err != nil {
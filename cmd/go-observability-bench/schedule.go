@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+// schedule reorders runs according to the given schedule and records the
+// schedule, seed and resulting order in every run.
+func schedule(runs []internal.RunConfig, schedule string, seed int64) ([]internal.RunConfig, error) {
+	var scheduled []internal.RunConfig
+	switch schedule {
+	case internal.ScheduleSequential:
+		scheduled = runs
+	case internal.ScheduleRoundRobin:
+		scheduled = roundRobin(runs)
+	case internal.ScheduleRandom:
+		scheduled = append(scheduled, runs...)
+		rng := rand.New(rand.NewSource(seed))
+		rng.Shuffle(len(scheduled), func(i, j int) {
+			scheduled[i], scheduled[j] = scheduled[j], scheduled[i]
+		})
+	default:
+		return nil, fmt.Errorf("unknown schedule: %q", schedule)
+	}
+
+	for i := range scheduled {
+		scheduled[i].Schedule = schedule
+		scheduled[i].Order = i
+		if schedule == internal.ScheduleRandom {
+			scheduled[i].Seed = seed
+		}
+	}
+	return scheduled, nil
+}
+
+// roundRobin groups the runs of an iteration that only differ in their
+// profile and tracing config, i.e. the runs that are compared to each other,
+// and rotates each group by one more position every iteration. This way
+// every config runs first, second and so on equally often across the
+// iterations, instead of the baseline always running first right after the
+// previous workload.
+func roundRobin(runs []internal.RunConfig) []internal.RunConfig {
+	var keys []string
+	groups := map[string][]internal.RunConfig{}
+	for _, run := range runs {
+		key := roundRobinKey(run)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], run)
+	}
+
+	scheduled := make([]internal.RunConfig, 0, len(runs))
+	for _, key := range keys {
+		group := groups[key]
+		shift := group[0].Iteration % len(group)
+		scheduled = append(scheduled, group[shift:]...)
+		scheduled = append(scheduled, group[:shift]...)
+	}
+	return scheduled
+}
+
+// roundRobinKey returns the same key for runs that only differ in their
+// profile and tracing config, and therefore in their name and outdir.
+func roundRobinKey(run internal.RunConfig) string {
+	run.Name, run.Outdir = "", ""
+	run.Profile, run.Tracing = internal.ProfileConfig{}, ""
+	return fmt.Sprintf("%+v", run)
+}
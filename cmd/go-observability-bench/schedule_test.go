@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+func TestRoundRobin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := `
+repeat: 3
+jobs:
+  - name: "${workload}/${concurrency}/${profilers}/${iteration}"
+    workload: [json, http]
+    concurrency: [1]
+    duration: [1s]
+    profile: [{}, cpu, mem]
+    exclude: [{workload: http, profilers: mem}]
+    args: [{}]
+`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Coordinator{Config: path}
+	conf, _, err := c.readConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs, err := c.runConfigs(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := func(name string) []string {
+		scheduled, err := schedule(append([]internal.RunConfig(nil), runs...), name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for i, run := range scheduled {
+			if run.Order != i || run.Schedule != name {
+				t.Errorf("%s: got order %d and schedule %q, want %d and %q", run.Name, run.Order, run.Schedule, i, name)
+			}
+			names = append(names, run.Name)
+		}
+		return names
+	}
+
+	sequential := order(internal.ScheduleSequential)
+	roundRobin := order(internal.ScheduleRoundRobin)
+	want := []string{
+		"json/1/none/0", "json/1/cpu/0", "json/1/mem/0", "http/1/none/0", "http/1/cpu/0",
+		"json/1/cpu/1", "json/1/mem/1", "json/1/none/1", "http/1/cpu/1", "http/1/none/1",
+		"json/1/mem/2", "json/1/none/2", "json/1/cpu/2", "http/1/none/2", "http/1/cpu/2",
+	}
+	if got := strings.Join(roundRobin, " "); got != strings.Join(want, " ") {
+		t.Errorf("got order:\n%s\nwant:\n%s", got, strings.Join(want, " "))
+	}
+	if strings.Join(roundRobin, " ") == strings.Join(sequential, " ") {
+		t.Errorf("round-robin order is the sequential order:\n%s", strings.Join(sequential, " "))
+	}
+}
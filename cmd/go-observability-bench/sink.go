@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+// profileSink ships the profiles of a run after they were stopped.
+type profileSink interface {
+	// Write ships the profile data with the given file name. It returns the
+	// name of the file the profile was written to, or "" if it wasn't.
+	Write(name string, data []byte) (string, error)
+	Close() error
+}
+
+// newProfileSink returns the sink with the given name, writing profiles to
+// outdir for internal.ProfileSinkDisk.
+func newProfileSink(name, outdir string) (profileSink, error) {
+	switch name {
+	case "", internal.ProfileSinkDisk:
+		return diskSink{dir: outdir}, nil
+	case internal.ProfileSinkDiscard:
+		return discardSink{}, nil
+	case internal.ProfileSinkHTTP:
+		agent := newFakeAgent(false)
+		return &httpSink{agent: agent, client: agent.server.Client()}, nil
+	default:
+		return nil, fmt.Errorf("unknown profile sink: %q", name)
+	}
+}
+
+type diskSink struct {
+	dir string
+}
+
+func (s diskSink) Write(name string, data []byte) (string, error) {
+	return name, ioutil.WriteFile(filepath.Join(s.dir, name), data, 0644)
+}
+
+func (s diskSink) Close() error { return nil }
+
+type discardSink struct{}
+
+func (discardSink) Write(string, []byte) (string, error) { return "", nil }
+
+func (discardSink) Close() error { return nil }
+
+// httpSink uploads profiles to a fake agent, simulating the cost of shipping
+// them over the network.
+type httpSink struct {
+	agent  *fakeAgent
+	client *http.Client
+}
+
+func (s *httpSink) Write(name string, data []byte) (string, error) {
+	res, err := s.client.Post(s.agent.server.URL+"/profiles/"+name, "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if _, err := ioutil.ReadAll(res.Body); err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upload of %s failed: %s", name, res.Status)
+	}
+	return "", nil
+}
+
+func (s *httpSink) Close() error {
+	s.agent.Close()
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Tracer wraps the ops of a run with the spans of a tracing library.
+type Tracer interface {
+	// Wrap returns a function that calls run inside of a span.
+	Wrap(run func() error) func() error
+	// Stop flushes pending spans, shuts the tracer down and returns the
+	// payloads received by its fake agent.
+	Stop() (internal.AgentStats, error)
+}
+
+// NewTracer starts the tracer with the given name, or returns nil for
+// internal.TracingNone.
+func NewTracer(name, workload string) (Tracer, error) {
+	switch name {
+	case "", internal.TracingNone:
+		return nil, nil
+	case internal.TracingDatadog:
+		return newDatadogTracer(workload), nil
+	case internal.TracingOpenTelemetry:
+		return newOtelTracer(workload)
+	default:
+		return nil, fmt.Errorf("unknown tracing: %q", name)
+	}
+}
+
+type datadogTracer struct {
+	agent    *fakeAgent
+	resource string
+}
+
+func newDatadogTracer(workload string) *datadogTracer {
+	t := &datadogTracer{agent: newFakeAgent(false), resource: workload}
+	tracer.Start(
+		tracer.WithAgentAddr(t.agent.Addr()),
+		tracer.WithService("go-observability-bench"),
+	)
+	return t
+}
+
+func (t *datadogTracer) Wrap(run func() error) func() error {
+	return func() error {
+		span := tracer.StartSpan("workload.run", tracer.ResourceName(t.resource))
+		err := run()
+		span.Finish(tracer.WithError(err))
+		return err
+	}
+}
+
+func (t *datadogTracer) Stop() (internal.AgentStats, error) {
+	tracer.Stop()
+	t.agent.Close()
+	return t.agent.Stats(), nil
+}
+
+// otelTracer uses the OpenTelemetry SDK to record a span as well as a counter
+// and histogram measurement for every op. Spans and metrics are exported via
+// OTLP/HTTP to a fake agent.
+type otelTracer struct {
+	agent    *fakeAgent
+	provider *sdktrace.TracerProvider
+	ctrl     *controller.Controller
+	tracer   trace.Tracer
+	ops      metric.Int64Counter
+	duration metric.Float64Histogram
+	attrs    []attribute.KeyValue
+}
+
+func newOtelTracer(workload string) (*otelTracer, error) {
+	ctx := context.Background()
+	t := &otelTracer{
+		agent: newFakeAgent(false),
+		attrs: []attribute.KeyValue{attribute.String("workload", workload)},
+	}
+
+	traceExp, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpoint(t.agent.Addr()),
+		otlptracehttp.WithInsecure(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	t.provider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(traceExp))
+	otel.SetTracerProvider(t.provider)
+	t.tracer = t.provider.Tracer("go-observability-bench")
+
+	metricExp, err := otlpmetrichttp.New(ctx,
+		otlpmetrichttp.WithEndpoint(t.agent.Addr()),
+		otlpmetrichttp.WithInsecure(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	t.ctrl = controller.New(
+		processor.NewFactory(simple.NewWithHistogramDistribution(), metricExp),
+		controller.WithExporter(metricExp),
+	)
+	if err := t.ctrl.Start(ctx); err != nil {
+		return nil, err
+	}
+	global.SetMeterProvider(t.ctrl)
+	meter := metric.Must(t.ctrl.Meter("go-observability-bench"))
+	t.ops = meter.NewInt64Counter("workload.ops")
+	t.duration = meter.NewFloat64Histogram("workload.duration")
+	return t, nil
+}
+
+func (t *otelTracer) Wrap(run func() error) func() error {
+	return func() error {
+		ctx, span := t.tracer.Start(context.Background(), "workload.run", trace.WithAttributes(t.attrs...))
+		start := time.Now()
+		err := run()
+		t.duration.Record(ctx, time.Since(start).Seconds(), t.attrs...)
+		t.ops.Add(ctx, 1, t.attrs...)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		return err
+	}
+}
+
+func (t *otelTracer) Stop() (internal.AgentStats, error) {
+	ctx := context.Background()
+	defer t.agent.Close()
+	if err := t.provider.Shutdown(ctx); err != nil {
+		return internal.AgentStats{}, err
+	} else if err := t.ctrl.Stop(ctx); err != nil {
+		return internal.AgentStats{}, err
+	}
+	return t.agent.Stats(), nil
+}
@@ -32,12 +32,6 @@ func expand(s string, vars map[string]interface{}) string {
 	return s
 }
 
-func closeAfter(dt time.Duration) chan struct{} {
-	ch := make(chan struct{})
-	time.AfterFunc(dt, func() { close(ch) })
-	return ch
-}
-
 func getRusage() (r internal.Rusage, err error) {
 	var raw syscall.Rusage
 	if err = syscall.Getrusage(0, &raw); err != nil {
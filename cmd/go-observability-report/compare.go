@@ -0,0 +1,333 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/felixge/go-observability-bench/internal/stat"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/yaml.v3"
+)
+
+const compareUsage = "usage: go-observability-report compare [-thresholds <file>] [-allow-missing] <baseline> <candidate>"
+
+// Thresholds configures the maximum increase of the overhead, in percentage
+// points, that compare accepts between two result sets. Unset thresholds are
+// not checked.
+type Thresholds struct {
+	MeanInc *float64 `yaml:"mean_inc"`
+	P99Inc  *float64 `yaml:"p99_inc"`
+	// Configs overrides the thresholds for matching configs, the first
+	// matching entry wins.
+	Configs []ConfigThresholds `yaml:"configs"`
+}
+
+// ConfigThresholds overrides the thresholds for the configs it matches. Empty
+// fields match any config.
+type ConfigThresholds struct {
+	Workload    string   `yaml:"workload"`
+	Concurrency int      `yaml:"concurrency"`
+	Profilers   string   `yaml:"profilers"`
+	MeanInc     *float64 `yaml:"mean_inc"`
+	P99Inc      *float64 `yaml:"p99_inc"`
+}
+
+func (ct ConfigThresholds) matches(c Config) bool {
+	return (ct.Workload == "" || ct.Workload == c.Workload) &&
+		(ct.Concurrency == 0 || ct.Concurrency == c.Concurrency) &&
+		(ct.Profilers == "" || ct.Profilers == c.Profilers)
+}
+
+// For returns the mean and p99 thresholds for c.
+func (t Thresholds) For(c Config) (meanInc, p99Inc *float64) {
+	meanInc, p99Inc = t.MeanInc, t.P99Inc
+	for _, ct := range t.Configs {
+		if !ct.matches(c) {
+			continue
+		}
+		if ct.MeanInc != nil {
+			meanInc = ct.MeanInc
+		}
+		if ct.P99Inc != nil {
+			p99Inc = ct.P99Inc
+		}
+		break
+	}
+	return
+}
+
+// ReadThresholds reads the thresholds from the yaml file at path.
+func ReadThresholds(path string) (Thresholds, error) {
+	var t Thresholds
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return t, err
+	}
+	return t, yaml.Unmarshal(data, &t)
+}
+
+// Verdicts of a Delta.
+const (
+	VerdictRegression  = "regression"
+	VerdictImprovement = "improvement"
+	VerdictNone        = "~"
+	// VerdictUnknown is used when there are not enough runs to compute a
+	// confidence interval.
+	VerdictUnknown = "n/a"
+	// VerdictMissing is used for configs of the baseline that are missing
+	// in the candidate, or that lack runs without profilers in either.
+	VerdictMissing = "missing"
+)
+
+// Delta is the change of the overhead of a config between two result sets.
+type Delta struct {
+	Config
+	Metric string
+	// Old and New are the overheads compared to the runs without profilers
+	// in percent, i.e. RunMeanInc or RunP99Inc. Delta is their difference in
+	// percentage points.
+	Old   float64
+	New   float64
+	Delta float64
+	CI    stat.Interval
+	// Verdict is VerdictRegression or VerdictImprovement if CI doesn't
+	// include 0.
+	Verdict   string
+	Threshold *float64
+	// Exceeded is true if the lower bound of CI is above the threshold, i.e.
+	// the overhead increased by more than the threshold with the configured
+	// confidence.
+	Exceeded bool
+	// Unchecked is true if there is a threshold but no confidence interval
+	// to check it against because there are less than two runs of a config.
+	Unchecked bool
+	// Missing is true if the overhead is missing in one of the result sets,
+	// Old or New is NaN then.
+	Missing bool
+}
+
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	thresholdsF := fs.String("thresholds", "", "Path to a yaml file with the max overhead increase per config")
+	allowMissingF := fs.Bool("allow-missing", false, "Don't fail if configs of the baseline are missing in the candidate")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("error: expected two outdirs (%s)", compareUsage)
+	}
+
+	var thresholds Thresholds
+	if *thresholdsF != "" {
+		var err error
+		if thresholds, err = ReadThresholds(*thresholdsF); err != nil {
+			return err
+		}
+	}
+
+	baseline, err := Analyze(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	candidate, err := Analyze(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	deltas := Compare(baseline, candidate, thresholds)
+	WriteDeltas(os.Stdout, deltas)
+
+	var exceeded, unchecked, missing int
+	for _, d := range deltas {
+		if d.Exceeded {
+			exceeded++
+		}
+		if d.Unchecked {
+			unchecked++
+		}
+		if d.Missing {
+			missing++
+		}
+	}
+	if exceeded > 0 {
+		return fmt.Errorf("%d of %d overhead deltas exceeded their threshold", exceeded, len(deltas))
+	} else if missing > 0 && !*allowMissingF {
+		return fmt.Errorf("%d of %d overhead deltas are missing, use -allow-missing to ignore them", missing, len(deltas))
+	} else if unchecked > 0 {
+		return fmt.Errorf("%d of %d overhead deltas can't be checked against their threshold, at least two runs of each config are needed", unchecked, len(deltas))
+	}
+	return nil
+}
+
+// Compare matches the configs of two result sets by workload, concurrency
+// and profilers and returns the change of their mean and p99 overhead. Configs
+// of the baseline whose overhead is missing in either result set are returned
+// as missing deltas.
+func Compare(baseline, candidate []*ConfigSummary, thresholds Thresholds) []*Delta {
+	index := func(table []*ConfigSummary) map[Config]*ConfigSummary {
+		m := map[Config]*ConfigSummary{}
+		for _, s := range table {
+			m[s.Config] = s
+		}
+		return m
+	}
+	oldSummaries, newSummaries := index(baseline), index(candidate)
+
+	type pair struct{ oldNone, old, curNone, cur *ConfigSummary }
+	var pairs []pair
+	for _, old := range baseline {
+		if old.Profilers == "none" {
+			continue
+		}
+		cur := newSummaries[old.Config]
+		noneKey := old.Config
+		noneKey.Profilers = "none"
+		pairs = append(pairs, pair{oldSummaries[noneKey], old, newSummaries[noneKey], cur})
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	var deltas []*Delta
+	for _, p := range pairs {
+		if p.cur == nil || p.old.Overhead == nil || p.cur.Overhead == nil {
+			deltas = append(deltas, missingDeltas(p.old, p.cur)...)
+			continue
+		}
+		meanThreshold, p99Threshold := thresholds.For(p.old.Config)
+		oldNoneMeans, oldNoneP99s := p.oldNone.runValues()
+		oldMeans, oldP99s := p.old.runValues()
+		curNoneMeans, curNoneP99s := p.curNone.runValues()
+		curMeans, curP99s := p.cur.runValues()
+		for _, m := range []struct {
+			name      string
+			old, cur  float64
+			samples   [][]float64
+			threshold *float64
+		}{
+			{"mean", p.old.RunMeanInc, p.cur.RunMeanInc, [][]float64{oldNoneMeans, oldMeans, curNoneMeans, curMeans}, meanThreshold},
+			{"p99", p.old.RunP99Inc, p.cur.RunP99Inc, [][]float64{oldNoneP99s, oldP99s, curNoneP99s, curP99s}, p99Threshold},
+		} {
+			d := &Delta{
+				Config:    p.old.Config,
+				Metric:    m.name,
+				Old:       m.old,
+				New:       m.cur,
+				Delta:     m.cur - m.old,
+				Threshold: m.threshold,
+			}
+			d.CI = stat.Bootstrap(m.samples, overheadDelta, confidence, resamples, rng)
+			switch {
+			case math.IsNaN(d.CI.Low):
+				d.Verdict = VerdictUnknown
+			case d.CI.Low > 0:
+				d.Verdict = VerdictRegression
+			case d.CI.High < 0:
+				d.Verdict = VerdictImprovement
+			default:
+				d.Verdict = VerdictNone
+			}
+			if d.Threshold != nil {
+				d.Exceeded = d.CI.Low > *d.Threshold
+				d.Unchecked = d.Verdict == VerdictUnknown
+			}
+			deltas = append(deltas, d)
+		}
+	}
+	return deltas
+}
+
+// missingDeltas returns the mean and p99 deltas of a config of the baseline
+// whose overhead is missing in the baseline or the candidate. cur is nil if
+// the config is missing in the candidate.
+func missingDeltas(old, cur *ConfigSummary) []*Delta {
+	overheads := func(s *ConfigSummary) (mean, p99 float64) {
+		if s == nil || s.Overhead == nil {
+			return math.NaN(), math.NaN()
+		}
+		return s.RunMeanInc, s.RunP99Inc
+	}
+	oldMean, oldP99 := overheads(old)
+	curMean, curP99 := overheads(cur)
+	var deltas []*Delta
+	for _, m := range []struct {
+		name     string
+		old, cur float64
+	}{
+		{"mean", oldMean, curMean},
+		{"p99", oldP99, curP99},
+	} {
+		deltas = append(deltas, &Delta{
+			Config:  old.Config,
+			Metric:  m.name,
+			Old:     m.old,
+			New:     m.cur,
+			Delta:   math.NaN(),
+			CI:      stat.Interval{Low: math.NaN(), High: math.NaN()},
+			Verdict: VerdictMissing,
+			Missing: true,
+		})
+	}
+	return deltas
+}
+
+// overheadDelta returns the change of the overhead in percentage points for
+// the samples: old baseline, old, new baseline and new.
+func overheadDelta(s [][]float64) float64 {
+	old := stat.Mean(s[1])/stat.Mean(s[0]) - 1
+	cur := stat.Mean(s[3])/stat.Mean(s[2]) - 1
+	return (cur - old) * 100
+}
+
+// WriteDeltas writes a table with the deltas to w.
+func WriteDeltas(w io.Writer, deltas []*Delta) {
+	tw := tablewriter.NewWriter(w)
+	tw.SetHeader([]string{"Workload", "Concurrency", "Profilers", "Metric", "Old", "New", "Delta", "CI", "Verdict", "Threshold"})
+	tw.SetBorder(false)
+	tw.SetCenterSeparator("")
+	tw.SetColumnSeparator("")
+	tw.SetRowSeparator("")
+	tw.SetHeaderLine(false)
+	tw.SetAutoWrapText(false)
+	for _, d := range deltas {
+		threshold := ""
+		if d.Threshold != nil {
+			threshold = formatPP(*d.Threshold)
+			if d.Exceeded {
+				threshold += " FAIL"
+			} else if d.Unchecked {
+				threshold += " unchecked"
+			}
+		}
+		ci := "n/a"
+		if !math.IsNaN(d.CI.Low) {
+			ci = fmt.Sprintf("[%+.2fpp, %+.2fpp]", d.CI.Low, d.CI.High)
+		}
+		tw.Append([]string{
+			d.Workload,
+			fmt.Sprint(d.Concurrency),
+			d.Profilers,
+			d.Metric,
+			formatMissing(formatInc, d.Old),
+			formatMissing(formatInc, d.New),
+			formatMissing(formatPP, d.Delta),
+			ci,
+			d.Verdict,
+			threshold,
+		})
+	}
+	tw.Render()
+}
+
+func formatPP(pp float64) string {
+	return fmt.Sprintf("%+.2fpp", pp)
+}
+
+// formatMissing formats v with format, or as "n/a" if it's NaN.
+func formatMissing(format func(float64) string, v float64) string {
+	if math.IsNaN(v) {
+		return "n/a"
+	}
+	return format(v)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	// summary returns a config whose runs have the given means in ms with a
+	// little noise, and p99s of twice the means.
+	summary := func(profilers string, mean float64, runs int) *ConfigSummary {
+		s := &ConfigSummary{Config: Config{Workload: "json", Concurrency: 1, Profilers: profilers}}
+		for i := 0; i < runs; i++ {
+			d := time.Duration((mean + 0.01*float64(i%3-1)) * float64(time.Millisecond))
+			s.Runs = append(s.Runs, &Run{Mean: d, P99: 2 * d})
+		}
+		return s
+	}
+	// results returns the baseline and a config with the given mean in ms.
+	results := func(mean float64, runs int) []*ConfigSummary {
+		none, cpu := summary("none", 1, runs), summary("cpu", mean, runs)
+		cpu.Overhead = &Overhead{}
+		cpu.RunMeanInc = (mean - 1) * 100
+		cpu.RunP99Inc = cpu.RunMeanInc
+		return []*ConfigSummary{none, cpu}
+	}
+	five := 5.0
+
+	tests := []struct {
+		name     string
+		old, new []*ConfigSummary
+		// want has one "<metric> <verdict> <exceeded> <unchecked>" line per
+		// delta.
+		want []string
+	}{
+		{
+			name: "no change",
+			old:  results(1.02, 5),
+			new:  results(1.02, 5),
+			want: []string{"mean ~ false false", "p99 ~ false false"},
+		},
+		{
+			name: "obvious regression",
+			old:  results(1.02, 5),
+			new:  results(1.50, 5),
+			want: []string{"mean regression true false", "p99 regression true false"},
+		},
+		{
+			name: "regression below the threshold",
+			old:  results(1.02, 5),
+			new:  results(1.04, 5),
+			want: []string{"mean regression false false", "p99 regression false false"},
+		},
+		{
+			name: "improvement",
+			old:  results(1.50, 5),
+			new:  results(1.02, 5),
+			want: []string{"mean improvement false false", "p99 improvement false false"},
+		},
+		{
+			name: "missing in the candidate",
+			old:  results(1.02, 5),
+			new:  results(1.02, 5)[:1],
+			want: []string{"mean missing false false", "p99 missing false false"},
+		},
+		{
+			name: "no runs without profilers in the candidate",
+			old:  results(1.02, 5),
+			new:  []*ConfigSummary{summary("cpu", 1.02, 5)},
+			want: []string{"mean missing false false", "p99 missing false false"},
+		},
+		{
+			name: "too few runs",
+			old:  results(1.02, 1),
+			new:  results(1.50, 1),
+			want: []string{"mean n/a false true", "p99 n/a false true"},
+		},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, d := range Compare(tt.old, tt.new, Thresholds{MeanInc: &five, P99Inc: &five}) {
+			got = append(got, fmt.Sprintf("%s %s %t %t", d.Metric, d.Verdict, d.Exceeded, d.Unchecked))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+// cdfPoints is the number of quantiles plotted for every latency CDF.
+const cdfPoints = 200
+
+// timelineBuckets is the number of intervals ops are counted in for the ops
+// over time charts.
+const timelineBuckets = 100
+
+// timeline is the throughput of a run over time together with the periods
+// its profilers were running.
+type timeline struct {
+	start  time.Time
+	bucket time.Duration
+	// ops is the number of ops started in every bucket.
+	ops []int
+	// measured is the measured part of the run, ops outside of it belong to
+	// the warmup or cooldown.
+	measuredStart time.Time
+	measuredEnd   time.Time
+	// warmup and cooldown are set if the run was configured with them or
+	// recorded ops in them.
+	warmup   bool
+	cooldown bool
+	profiles []internal.RunProfile
+}
+
+// readTimeline reads the timeline of the run described by meta from its
+// ops.csv. It returns nil for runs that recorded a histogram.
+func readTimeline(meta *internal.RunMeta, opsPath string) (*timeline, error) {
+	if meta.Histogram > 0 {
+		return nil, nil
+	}
+	ops, err := readOps(opsPath)
+	if err != nil || len(ops) == 0 {
+		return nil, err
+	}
+
+	t := &timeline{
+		start:    ops[0].Start,
+		warmup:   meta.Warmup > 0,
+		cooldown: meta.Cooldown > 0,
+		profiles: meta.Profiles,
+	}
+	end := ops[0].Start
+	for _, op := range ops {
+		switch op.Phase {
+		case internal.PhaseWarmup:
+			t.warmup = true
+		case internal.PhaseCooldown:
+			t.cooldown = true
+		}
+		if op.Start.Before(t.start) {
+			t.start = op.Start
+		}
+		if op.Start.After(end) {
+			end = op.Start
+		}
+		if op.Measured() {
+			if t.measuredStart.IsZero() || op.Start.Before(t.measuredStart) {
+				t.measuredStart = op.Start
+			}
+			if op.Start.After(t.measuredEnd) {
+				t.measuredEnd = op.Start
+			}
+		}
+	}
+	t.bucket = end.Sub(t.start)/timelineBuckets + 1
+	t.ops = make([]int, timelineBuckets+1)
+	for _, op := range ops {
+		t.ops[op.Start.Sub(t.start)/t.bucket]++
+	}
+	return t, nil
+}
+
+// Quantiles returns the latencies at n+1 evenly spaced quantiles.
+func (l *runLatencies) Quantiles(n int) []time.Duration {
+	q := make([]time.Duration, n+1)
+	if l.hist != nil {
+		for i := range q {
+			q[i] = l.hist.Percentile(100 * float64(i) / float64(n))
+		}
+		return q
+	}
+	if len(l.durations) == 0 {
+		return nil
+	}
+	sorted := append([]time.Duration(nil), l.durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for i := range q {
+		q[i] = sorted[i*(len(sorted)-1)/n]
+	}
+	return q
+}
+
+type htmlReport struct {
+	Title     string
+	Workloads []*htmlWorkload
+}
+
+type htmlWorkload struct {
+	Name      string
+	Overhead  template.HTML
+	CDFs      []htmlChart
+	Timelines []htmlChart
+}
+
+type htmlChart struct {
+	Title string
+	SVG   template.HTML
+}
+
+// WriteHTML writes a self-contained HTML report with charts for every
+// workload in table to path.
+func WriteHTML(path, title string, table []*ConfigSummary) error {
+	report := &htmlReport{Title: title}
+	byWorkload := map[string][]*ConfigSummary{}
+	var names []string
+	for _, s := range table {
+		if byWorkload[s.Workload] == nil {
+			names = append(names, s.Workload)
+		}
+		byWorkload[s.Workload] = append(byWorkload[s.Workload], s)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		summaries := byWorkload[name]
+		sort.Slice(summaries, func(i, j int) bool { return summaries[i].Config.Less(summaries[j].Config) })
+		w := &htmlWorkload{Name: name, Overhead: overheadChart(summaries)}
+
+		byConcurrency := map[int][]*ConfigSummary{}
+		var concurrencies []int
+		for _, s := range summaries {
+			if byConcurrency[s.Concurrency] == nil {
+				concurrencies = append(concurrencies, s.Concurrency)
+			}
+			byConcurrency[s.Concurrency] = append(byConcurrency[s.Concurrency], s)
+		}
+		for _, c := range concurrencies {
+			w.CDFs = append(w.CDFs, htmlChart{
+				Title: fmt.Sprintf("concurrency %d", c),
+				SVG:   cdfChart(byConcurrency[c]),
+			})
+		}
+		for _, s := range summaries {
+			if s.timeline == nil {
+				continue
+			}
+			w.Timelines = append(w.Timelines, htmlChart{
+				Title: fmt.Sprintf("concurrency %d, %s", s.Concurrency, s.Profilers),
+				SVG:   timelineChart(s.timeline),
+			})
+		}
+		report.Workloads = append(report.Workloads, w)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := htmlTemplate.Execute(file, report); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// overheadChart plots the mean and p99 overhead of every config with their
+// confidence intervals.
+func overheadChart(summaries []*ConfigSummary) template.HTML {
+	var compared []*ConfigSummary
+	minY, maxY := 0.0, 1.0
+	for _, s := range summaries {
+		if s.Overhead == nil {
+			continue
+		}
+		compared = append(compared, s)
+		for _, v := range []float64{s.RunMeanInc, s.RunP99Inc, s.Overhead.MeanIncCI.Low, s.Overhead.MeanIncCI.High, s.Overhead.P99IncCI.Low, s.Overhead.P99IncCI.High} {
+			if !math.IsNaN(v) {
+				minY, maxY = math.Min(minY, v), math.Max(maxY, v)
+			}
+		}
+	}
+	if len(compared) == 0 {
+		return ""
+	}
+
+	pad := (maxY - minY) * 0.05
+	c := newSVGChart(math.Max(400, float64(len(compared))*70+100), 320,
+		axis{min: 0, max: float64(len(compared))},
+		axis{min: minY - pad, max: maxY + pad, label: "overhead", format: func(v float64) string { return fmt.Sprintf("%+.0f%%", v) }},
+	)
+	for i, s := range compared {
+		x := float64(i) + 0.5
+		o := s.Overhead
+		c.Bar(x-0.17, 0.3, s.RunMeanInc, o.MeanIncCI.Low, o.MeanIncCI.High, palette[0], fmt.Sprintf("mean %s", formatInc(s.RunMeanInc)))
+		c.Bar(x+0.17, 0.3, s.RunP99Inc, o.P99IncCI.Low, o.P99IncCI.High, palette[1], fmt.Sprintf("p99 %s", formatInc(s.RunP99Inc)))
+		c.XLabel(x, fmt.Sprintf("c%d %s", s.Concurrency, s.Profilers))
+	}
+	c.legend = []legendEntry{{"mean", palette[0]}, {"p99", palette[1]}}
+	return c.SVG()
+}
+
+// cdfChart plots the latency CDFs of the given configs on a log scale.
+func cdfChart(summaries []*ConfigSummary) template.HTML {
+	minX, maxX := math.Inf(1), 0.0
+	quantiles := make([][]time.Duration, len(summaries))
+	for i, s := range summaries {
+		quantiles[i] = s.latencies.Quantiles(cdfPoints)
+		for _, q := range quantiles[i] {
+			if q > 0 {
+				minX, maxX = math.Min(minX, float64(q)), math.Max(maxX, float64(q))
+			}
+		}
+	}
+	if maxX == 0 {
+		return ""
+	}
+
+	c := newSVGChart(700, 360,
+		axis{min: minX, max: maxX, log: true, label: "latency", format: func(v float64) string {
+			return internal.TruncateDuration(time.Duration(v)).String()
+		}},
+		axis{min: 0, max: 1, label: "fraction of ops", format: func(v float64) string { return fmt.Sprintf("%.1f", v) }},
+	)
+	for i, s := range summaries {
+		var points [][2]float64
+		for j, q := range quantiles[i] {
+			if q > 0 {
+				points = append(points, [2]float64{float64(q), float64(j) / cdfPoints})
+			}
+		}
+		c.Line(points, palette[i%len(palette)], s.Profilers)
+	}
+	return c.SVG()
+}
+
+// timelineChart plots the ops per second of a run over time. The warmup and
+// cooldown, if the run had them, are shaded grey and the profiling periods green, with the time
+// spent stopping the profilers in red and shipping them to the sink in teal.
+func timelineChart(t *timeline) template.HTML {
+	var points [][2]float64
+	maxY := 0.0
+	for i, n := range t.ops {
+		rate := float64(n) / t.bucket.Seconds()
+		maxY = math.Max(maxY, rate)
+		points = append(points, [2]float64{(time.Duration(i) * t.bucket).Seconds(), rate})
+	}
+	maxX := (time.Duration(len(t.ops)) * t.bucket).Seconds()
+	c := newSVGChart(700, 240,
+		axis{min: 0, max: maxX, label: "time (s)", format: func(v float64) string { return fmt.Sprintf("%.1f", v) }},
+		axis{min: 0, max: maxY * 1.1, label: "ops/s", format: func(v float64) string { return fmt.Sprintf("%.0f", v) }},
+	)
+	sec := func(ts time.Time) float64 {
+		return math.Max(0, math.Min(maxX, ts.Sub(t.start).Seconds()))
+	}
+	if t.warmup && !t.measuredStart.IsZero() {
+		c.Span(0, sec(t.measuredStart), "#999", "warmup")
+	}
+	if t.cooldown && !t.measuredStart.IsZero() {
+		c.Span(sec(t.measuredEnd), maxX, "#999", "cooldown")
+	}
+	for _, p := range t.profiles {
+		stop := p.Start.Add(p.ProfileDuration)
+		title := p.Kind
+		if p.Error != "" {
+			title += ": " + p.Error
+		}
+		c.Span(sec(p.Start), sec(stop), palette[2], title)
+		c.Span(sec(stop), sec(stop.Add(p.StopDuration)), palette[3], fmt.Sprintf("%s stop (%s)", p.Kind, p.StopDuration))
+		if p.SinkDuration > 0 {
+			shipped := stop.Add(p.StopDuration)
+			c.Span(sec(shipped), sec(shipped.Add(p.SinkDuration)), palette[4], fmt.Sprintf("%s sink (%s)", p.Kind, p.SinkDuration))
+		}
+		c.VLine(sec(p.Start), palette[2], p.Kind+" start")
+	}
+	c.Line(points, palette[0], "")
+	return c.SVG()
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h2 { border-bottom: 1px solid #ccc; padding-bottom: 0.2em; }
+figure { display: inline-block; margin: 0 1em 1em 0; }
+figcaption { font-size: 0.9em; color: #555; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Workloads}}
+<h2>{{.Name}}</h2>
+{{if .Overhead}}<h3>Overhead</h3>
+<figure>{{.Overhead}}<figcaption>Mean and p99 latency overhead compared to no profilers, with 95% confidence intervals.</figcaption></figure>{{end}}
+<h3>Latency distribution</h3>
+{{range .CDFs}}<figure>{{.SVG}}<figcaption>{{.Title}}</figcaption></figure>
+{{end}}
+{{if .Timelines}}<h3>Ops over time</h3>
+{{range .Timelines}}<figure>{{.SVG}}<figcaption>{{.Title}}</figcaption></figure>
+{{end}}{{end}}
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+func TestTimelineChart(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		warmup   bool
+		cooldown bool
+	}{
+		{"neither", false, false},
+		{"warmup", true, false},
+		{"cooldown", false, true},
+		{"both", true, true},
+	}
+	for _, tt := range tests {
+		tl := &timeline{
+			start:         start,
+			bucket:        100 * time.Millisecond,
+			ops:           []int{5, 10, 10, 10, 10, 10, 10, 10, 10, 5},
+			measuredStart: start.Add(100 * time.Millisecond),
+			measuredEnd:   start.Add(900 * time.Millisecond),
+			warmup:        tt.warmup,
+			cooldown:      tt.cooldown,
+			profiles: []internal.RunProfile{{
+				Kind:            "cpu",
+				Start:           start.Add(200 * time.Millisecond),
+				ProfileDuration: 500 * time.Millisecond,
+				Error:           `<oops & "fail">`,
+			}},
+		}
+		svg := string(timelineChart(tl))
+		checkSVG(t, tt.name, svg)
+		if got := strings.Contains(svg, "<title>warmup</title>"); got != tt.warmup {
+			t.Errorf("%s: got warmup band %v, want %v", tt.name, got, tt.warmup)
+		}
+		if got := strings.Contains(svg, "<title>cooldown</title>"); got != tt.cooldown {
+			t.Errorf("%s: got cooldown band %v, want %v", tt.name, got, tt.cooldown)
+		}
+		if want := "<title>cpu: &lt;oops &amp; &#34;fail&#34;&gt;</title>"; !strings.Contains(svg, want) {
+			t.Errorf("%s: missing escaped profile error %s in:\n%s", tt.name, want, svg)
+		}
+	}
+}
+
+func TestSVGChart(t *testing.T) {
+	evil := `</text><script>alert("x")</script>`
+	c := newSVGChart(300, 200,
+		axis{min: 0, max: 10, label: evil, format: func(v float64) string { return evil }},
+		axis{min: 0, max: 1, label: evil},
+	)
+	c.Line([][2]float64{{0, 0}, {10, 1}}, palette[0], evil)
+	c.Bar(5, 1, 0.5, 0.4, 0.6, palette[1], evil)
+	c.VLine(5, palette[2], evil)
+	c.Span(1, 2, palette[3], evil)
+	c.XLabel(5, evil)
+	svg := string(c.SVG())
+
+	checkSVG(t, "chart", svg)
+	if strings.Contains(svg, "<script>") {
+		t.Errorf("unescaped label in:\n%s", svg)
+	}
+	for _, elem := range []string{"<polyline ", "<rect ", "<line ", "<path "} {
+		if !strings.Contains(svg, elem) {
+			t.Errorf("missing %s element in:\n%s", elem, svg)
+		}
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.html")
+	table := []*ConfigSummary{
+		{
+			Config:    Config{Workload: "<b>json</b>", Concurrency: 1, Profilers: "none"},
+			latencies: &runLatencies{durations: []time.Duration{time.Millisecond, 2 * time.Millisecond}},
+		},
+	}
+	if err := WriteHTML(path, `a & <i>b</i>`, table); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		"<title>a &amp; &lt;i&gt;b&lt;/i&gt;</title>",
+		"<h2>&lt;b&gt;json&lt;/b&gt;</h2>",
+		"<svg ",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+}
+
+// checkSVG fails the test if svg is not a single well-formed svg element.
+func checkSVG(t *testing.T, name, svg string) {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(svg))
+	depth, roots := 0, 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Errorf("%s: malformed svg: %s:\n%s", name, err, svg)
+			return
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+				if tok.Name.Local != "svg" {
+					t.Errorf("%s: got root element %s, want svg", name, tok.Name.Local)
+				}
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if roots != 1 {
+		t.Errorf("%s: got %d root elements, want 1", name, roots)
+	}
+}
@@ -7,15 +7,18 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
 	"github.com/felixge/go-observability-bench/internal"
 	"github.com/iancoleman/strcase"
 	"github.com/montanaflynn/stats"
+	"gopkg.in/yaml.v3"
 )
 
 func main() {
@@ -26,23 +29,96 @@ func main() {
 }
 
 func run() error {
+	var (
+		htmlF         = flag.String("html", "report.html", "Path of the HTML report, empty to disable it")
+		prefixF       = flag.String("prefix", "go11y", "Prefix of the metric names sent to the sinks")
+		statsdF       = flag.String("statsd", "127.0.0.1:8125", "Address of the statsd server, empty to disable it")
+		statsdTagsF   = flag.String("statsd-tags", "", "Comma separated tags to add to all statsd metrics, e.g. env:ci,host:foo")
+		openMetricsF  = flag.String("openmetrics", "", "Path of an OpenMetrics text file to write the metrics to")
+		listenF       = flag.String("listen", "", "Address to serve the metrics on /metrics at until interrupted, e.g. :9090")
+		spikesF       = flag.Bool("spikes", false, "Print the latency spikes of every run compared to its baseline and their attributed cause")
+		profileStatsF = flag.String("profile-stats", "", "Path of a YAML file to write the stats of the pprof files of every run to")
+	)
 	flag.Parse()
-	table, err := Analyze(flag.Arg(0))
-	if err != nil {
+	switch flag.Arg(0) {
+	case "compare":
+		return runCompare(flag.Args()[1:])
+	case "validate":
+		return runValidate(flag.Args()[1:])
+	}
+
+	session, err := internal.ReadSession(flag.Arg(0))
+	if err == nil {
+		if done := session.Done(); done < len(session.Runs) {
+			fmt.Fprintf(os.Stderr, "warning: incomplete session, %d of %d runs done\n", done, len(session.Runs))
+		}
+	} else if !os.IsNotExist(err) {
 		return err
 	}
 
-	statsd, err := statsd.New("127.0.1:8125")
+	if err := AnalyzeProfiles(flag.Arg(0), *profileStatsF); err != nil {
+		return err
+	}
+	if err := CheckWorkers(flag.Arg(0)); err != nil {
+		return err
+	}
+	table, err := Analyze(flag.Arg(0))
 	if err != nil {
 		return err
 	}
+	WriteSummary(os.Stdout, table)
+	if *spikesF {
+		events, err := DetectSpikes(flag.Arg(0))
+		if err != nil {
+			return err
+		} else if len(events) > 0 {
+			fmt.Println()
+			WriteSpikes(os.Stdout, events)
+		}
+	}
+	if *htmlF != "" {
+		if err := WriteHTML(*htmlF, filepath.Base(flag.Arg(0)), table); err != nil {
+			return err
+		}
+	}
+
 	if err := WriteGoBench("gobench", table); err != nil {
 		return err
-	} else if err := SendStatsd(statsd, table); err != nil {
-		return err
 	}
 
-	return statsd.Close()
+	var sinks []Sink
+	if *statsdF != "" {
+		var tags []string
+		if *statsdTagsF != "" {
+			tags = strings.Split(*statsdTagsF, ",")
+		}
+		sink, err := NewStatsdSink(*statsdF, *prefixF, tags)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if *openMetricsF != "" {
+		sinks = append(sinks, &OpenMetricsFileSink{Path: *openMetricsF, Prefix: *prefixF})
+	}
+	var handler *OpenMetricsHandler
+	if *listenF != "" {
+		handler = &OpenMetricsHandler{Prefix: *prefixF}
+		sinks = append(sinks, handler)
+	}
+	for _, sink := range sinks {
+		if err := sink.Send(table); err != nil {
+			return err
+		} else if err := sink.Close(); err != nil {
+			return err
+		}
+	}
+
+	if handler != nil {
+		fmt.Fprintf(os.Stderr, "serving metrics on http://%s/metrics\n", *listenF)
+		return http.ListenAndServe(*listenF, handler)
+	}
+	return nil
 }
 
 func WriteGoBench(dir string, table []*ConfigSummary) error {
@@ -82,39 +158,99 @@ BenchmarkJSON-12             469           2561828 ns/op
 BenchmarkJSON-12             468           2568088 ns/op
 */
 
+// RunProfileStats holds the pprof files of a run with their stats.
+type RunProfileStats struct {
+	Run      string                `yaml:"run"`
+	Profiles []internal.RunProfile `yaml:"profiles"`
+}
+
+// AnalyzeProfiles computes the stats of the pprof files of every run in dir
+// and prints the anomalies found. The stats are written to statsPath unless
+// it's empty, the runs in dir are never modified.
+func AnalyzeProfiles(dir, statsPath string) error {
+	var all []RunProfileStats
+	err := internal.ReadMeta(dir, func(meta *internal.RunMeta, opsPath string) error {
+		meta.AnalyzeProfiles(filepath.Dir(opsPath))
+		run := RunProfileStats{Run: meta.Name}
+		for _, p := range meta.Profiles {
+			if p.Stats == nil {
+				continue
+			}
+			for _, a := range p.Stats.Anomalies {
+				fmt.Fprintf(os.Stderr, "warning: %s: %s: %s\n", meta.Name, p.File, a)
+			}
+			run.Profiles = append(run.Profiles, p)
+		}
+		if len(run.Profiles) > 0 {
+			all = append(all, run)
+		}
+		return nil
+	})
+	if err != nil || statsPath == "" {
+		return err
+	}
+	data, err := yaml.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(statsPath, data, 0644)
+}
+
+// minFairness is the fairness index of the op counts of the workers of a run
+// below which a warning is printed, see internal.Fairness.
+const minFairness = 0.9
+
+// CheckWorkers prints a warning for every run in dir whose workers executed
+// very different numbers of ops, e.g. because one of them stalled.
+func CheckWorkers(dir string) error {
+	return internal.ReadMeta(dir, func(meta *internal.RunMeta, _ string) error {
+		workers := meta.Stats.Workers
+		if len(workers) < 2 || meta.Stats.Fairness >= minFairness {
+			return nil
+		}
+		min, max := workers[0], workers[0]
+		for _, w := range workers[1:] {
+			if w.OpsCount < min.OpsCount {
+				min = w
+			}
+			if w.OpsCount > max.OpsCount {
+				max = w
+			}
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s: unfair workers (fairness %.2f): worker %d executed %d ops (max %s), worker %d executed %d ops (max %s)\n",
+			meta.Name, meta.Stats.Fairness, min.Worker, min.OpsCount, min.MaxDuration, max.Worker, max.OpsCount, max.MaxDuration)
+		return nil
+	})
+}
+
 func Analyze(dir string) ([]*ConfigSummary, error) {
-	configOps := map[Config][][]*internal.RunOp{}
+	configRuns := map[Config][]*runLatencies{}
+	// timelines holds the timeline of the first run of every config.
+	timelines := map[Config]*timeline{}
+	// instructions holds the user space instructions and ops of the runs
+	// that recorded perf counters.
+	instructions := map[Config]*instructionTotals{}
 	err := internal.ReadMeta(dir, func(meta *internal.RunMeta, opsPath string) error {
-		csvFile, err := os.Open(opsPath)
+		run, err := readLatencies(meta, opsPath)
 		if err != nil {
 			return err
 		}
-		defer csvFile.Close()
-		cr := csv.NewReader(csvFile)
-		var ops []*internal.RunOp
-		for header := true; ; header = false {
-			record, err := cr.Read()
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				return err
-			} else if header {
-				continue
-			}
-
-			var op internal.RunOp
-			if err := op.FromRecord(record); err != nil {
+		config := runConfig(meta)
+		configRuns[config] = append(configRuns[config], run)
+		if _, ok := timelines[config]; !ok {
+			if timelines[config], err = readTimeline(meta, opsPath); err != nil {
 				return err
 			}
-			ops = append(ops, &op)
 		}
-		profilers := strings.Join(meta.Profile.Profilers(), "+")
-		config := Config{
-			Workload:    meta.Workload,
-			Concurrency: meta.Concurrency,
-			Profilers:   profilers,
+		if pc := meta.RunResult.PerfCounters; pc != nil && pc.Instructions > 0 {
+			total := instructions[config]
+			if total == nil {
+				total = &instructionTotals{}
+				instructions[config] = total
+			}
+			total.instructions += pc.Instructions
+			total.ops += meta.Stats.OpsCount
 		}
-		configOps[config] = append(configOps[config], ops)
 		return nil
 	})
 	if err != nil {
@@ -123,54 +259,207 @@ func Analyze(dir string) ([]*ConfigSummary, error) {
 
 	var sList []*ConfigSummary
 	sMap := map[Config]*ConfigSummary{}
-	for config, runs := range configOps {
+	for config, runs := range configRuns {
 		summary := &ConfigSummary{}
 		var (
-			allDurations []time.Duration
-			runMeans     []time.Duration
-			runP99s      []time.Duration
+			all      = &runLatencies{}
+			runMeans []time.Duration
+			runP99s  []time.Duration
 		)
-		for _, runOps := range runs {
-			var runDurations []time.Duration
-			for _, op := range runOps {
-				runDurations = append(runDurations, op.Duration)
-			}
-			runMean := durationMean(runDurations)
+		for _, run := range runs {
+			runMean := run.Mean()
+			runP99 := run.Percentile(99)
 			summary.Runs = append(summary.Runs, &Run{
 				Mean: runMean,
-				Ops:  len(runOps),
+				P99:  runP99,
+				Ops:  run.Count(),
 			})
 			runMeans = append(runMeans, runMean)
-			runP99s = append(runP99s, durationPercentile(runDurations, 99))
-			allDurations = append(allDurations, runDurations...)
+			runP99s = append(runP99s, runP99)
+			if err := all.Add(run); err != nil {
+				return nil, err
+			}
 		}
 
-		summary.Ops = len(allDurations)
-		summary.P99 = durationPercentile(allDurations, 99)
+		summary.Ops = all.Count()
+		summary.P99 = all.Percentile(99)
 		summary.P99Stdev = durationStdev(runP99s)
-		summary.Mean = durationMean(allDurations)
+		summary.Mean = all.Mean()
 		summary.MeanStdev = durationStdev(runMeans)
+		summary.RunMean = durationMean(runMeans)
+		summary.RunP99 = durationMean(runP99s)
+		if total := instructions[config]; total != nil && total.ops > 0 {
+			summary.InstructionsPerOp = float64(total.instructions) / float64(total.ops)
+		}
 		summary.Config = config
+		summary.latencies = all
+		summary.timeline = timelines[config]
 		sList = append(sList, summary)
 		sMap[config] = summary
 	}
 
+	// The bootstrap is seeded with a constant and the summaries are sorted to
+	// make the report reproducible.
+	sort.Slice(sList, func(i, j int) bool { return sList[i].Config.Less(sList[j].Config) })
+	rng := rand.New(rand.NewSource(1))
+	// families holds the summaries compared against every baseline, they
+	// are corrected for multiple comparisons together.
+	var baselines []*ConfigSummary
+	families := map[*ConfigSummary][]*ConfigSummary{}
 	for _, s := range sList {
 		noneKey := s.Config
 		noneKey.Profilers = "none"
-		s.MeanInc = (float64(s.Mean)/float64(sMap[noneKey].Mean) - 1) * 100
-		s.P99Inc = (float64(s.P99)/float64(sMap[noneKey].P99) - 1) * 100
+		none := sMap[noneKey]
+		if none == nil {
+			continue
+		}
+		s.MeanInc = (float64(s.Mean)/float64(none.Mean) - 1) * 100
+		s.P99Inc = (float64(s.P99)/float64(none.P99) - 1) * 100
+		s.RunMeanInc = (float64(s.RunMean)/float64(none.RunMean) - 1) * 100
+		s.RunP99Inc = (float64(s.RunP99)/float64(none.RunP99) - 1) * 100
+		if s.InstructionsPerOp > 0 && none.InstructionsPerOp > 0 {
+			s.InstructionsPerOpInc = s.InstructionsPerOp - none.InstructionsPerOp
+		}
+		if s != none {
+			s.compare(none, rng)
+			if families[none] == nil {
+				baselines = append(baselines, none)
+			}
+			families[none] = append(families[none], s)
+		}
+	}
+	for _, none := range baselines {
+		adjustPValues(families[none])
 	}
 
 	return sList, nil
 }
 
+// runLatencies holds the op latencies of one or more runs, either as the
+// individual durations from ops.csv or as a histogram.
+type runLatencies struct {
+	durations []time.Duration
+	hist      *internal.Histogram
+}
+
+// readLatencies reads the latencies of the run described by meta from its
+// histogram file or ops.csv.
+func readLatencies(meta *internal.RunMeta, opsPath string) (*runLatencies, error) {
+	if meta.Histogram > 0 {
+		hist, err := internal.ReadHistogram(filepath.Join(filepath.Dir(opsPath), internal.HistogramFile))
+		return &runLatencies{hist: hist}, err
+	}
+
+	ops, err := readOps(opsPath)
+	if err != nil {
+		return nil, err
+	}
+	run := &runLatencies{}
+	for _, op := range ops {
+		if op.Measured() {
+			run.durations = append(run.durations, op.Duration)
+		}
+	}
+	return run, nil
+}
+
+// readOps reads all ops from the ops.csv file at path.
+func readOps(path string) ([]internal.RunOp, error) {
+	csvFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer csvFile.Close()
+	cr := csv.NewReader(csvFile)
+	var ops []internal.RunOp
+	for header := true; ; header = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		} else if header {
+			continue
+		}
+
+		var op internal.RunOp
+		if err := op.FromRecord(record); err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// Add merges the latencies of o into l. If either of them is a histogram, l
+// becomes a histogram.
+func (l *runLatencies) Add(o *runLatencies) error {
+	if o.hist != nil && l.hist == nil {
+		l.hist, _ = internal.NewHistogram(o.hist.Digits)
+		for _, d := range l.durations {
+			l.hist.Record(d)
+		}
+		l.durations = nil
+	}
+	if l.hist == nil {
+		l.durations = append(l.durations, o.durations...)
+		return nil
+	}
+	for _, d := range o.durations {
+		l.hist.Record(d)
+	}
+	if o.hist != nil {
+		return l.hist.Merge(o.hist)
+	}
+	return nil
+}
+
+func (l *runLatencies) Count() int {
+	if l.hist != nil {
+		return l.hist.Count
+	}
+	return len(l.durations)
+}
+
+func (l *runLatencies) Mean() time.Duration {
+	if l.hist != nil {
+		return l.hist.Mean()
+	}
+	return durationMean(l.durations)
+}
+
+func (l *runLatencies) Percentile(percentile float64) time.Duration {
+	if l.hist != nil {
+		return l.hist.Percentile(percentile)
+	}
+	return durationPercentile(l.durations, percentile)
+}
+
 type Config struct {
 	Workload    string
 	Concurrency int
 	Profilers   string
 }
 
+// runConfig returns the config the run described by meta belongs to.
+func runConfig(meta *internal.RunMeta) Config {
+	return Config{
+		Workload:    meta.Workload,
+		Concurrency: meta.Concurrency,
+		Profilers:   strings.Join(meta.Instrumentation(), "+"),
+	}
+}
+
+// Less orders configs by workload, concurrency and profilers.
+func (c Config) Less(o Config) bool {
+	if c.Workload != o.Workload {
+		return c.Workload < o.Workload
+	} else if c.Concurrency != o.Concurrency {
+		return c.Concurrency < o.Concurrency
+	}
+	return c.Profilers < o.Profilers
+}
+
 type ConfigSummary struct {
 	Config
 	Ops       int
@@ -182,16 +471,42 @@ type ConfigSummary struct {
 	P99Stdev time.Duration
 	P99Inc   float64
 
+	// RunMean and RunP99 are the means of the per-run means and p99s, and
+	// RunMeanInc and RunP99Inc their increase compared to the baseline. The
+	// confidence intervals and the test of Overhead are computed over the
+	// runs, so these are the estimates that match them.
+	RunMean    time.Duration
+	RunP99     time.Duration
+	RunMeanInc float64
+	RunP99Inc  float64
+
+	// InstructionsPerOp is the number of user space instructions executed
+	// per op, and InstructionsPerOpInc the number of extra instructions per
+	// op compared to the baseline. Both are 0 without perf counters.
+	InstructionsPerOp    float64
+	InstructionsPerOpInc float64
+
+	// Overhead compares the runs against the runs without profilers, it's
+	// nil for the baseline itself.
+	Overhead *Overhead
+
 	Runs []*Run
 
-	// TODO more stuff, p99, p99inc, etc.
+	latencies *runLatencies
+	timeline  *timeline
 }
 
 type Run struct {
 	Mean time.Duration
+	P99  time.Duration
 	Ops  int
 }
 
+type instructionTotals struct {
+	instructions uint64
+	ops          int
+}
+
 func durationStdev(durations []time.Duration) time.Duration {
 	stdev, _ := stats.StdDevS(durationsToFloats(durations))
 	return time.Duration(stdev)
@@ -214,28 +529,3 @@ func durationsToFloats(durations []time.Duration) stats.Float64Data {
 	}
 	return floats
 }
-
-func SendStatsd(statsd *statsd.Client, table []*ConfigSummary) error {
-	for _, s := range table {
-		if err := s.SendStatsd(statsd); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (s *ConfigSummary) SendStatsd(client *statsd.Client) error {
-	tags := []string{
-		fmt.Sprintf("profilers:%s", s.Profilers),
-		fmt.Sprintf("workload:%s", s.Workload),
-		fmt.Sprintf("concurrency:%d", s.Concurrency),
-	}
-	client.Gauge("go11y.ops", float64(s.Ops), tags, 1)
-	client.Gauge("go11y.mean", s.Mean.Seconds(), tags, 1)
-	client.Gauge("go11y.mean_stdev", s.MeanStdev.Seconds(), tags, 1)
-	client.Gauge("go11y.mean_inc", s.MeanInc, tags, 1)
-	client.Gauge("go11y.p99", s.P99.Seconds(), tags, 1)
-	client.Gauge("go11y.p99_stdev", s.P99Stdev.Seconds(), tags, 1)
-	client.Gauge("go11y.p99_inc", s.P99Inc, tags, 1)
-	return nil
-}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+
+	"github.com/felixge/go-observability-bench/internal"
+	"github.com/felixge/go-observability-bench/internal/stat"
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	// confidence is the level of the bootstrap confidence intervals.
+	confidence = 0.95
+	// resamples is the number of bootstrap resamples.
+	resamples = 10000
+	// alpha is the significance level of the adjusted p-values.
+	alpha = 0.05
+)
+
+// Overhead describes the overhead of a config compared to its baseline. The
+// intervals and the p-value are computed over the means and p99s of the
+// individual runs, so they require at least two runs of each config.
+//
+// Runs are the unit of the test because ops of the same run are not
+// independent. With n runs of each config the smallest p-value the test can
+// produce is 2/C(2n, n), which has to stay below alpha after the correction
+// for the number of configs compared against the same baseline. That
+// requires 4 runs for a single config, 5 for up to 6 configs, 6 for up to 23
+// and 7 for up to 85, see MinRuns.
+type Overhead struct {
+	// MeanIncCI and P99IncCI are the confidence intervals of RunMeanInc and
+	// RunP99Inc in percent. They are NaN for less than two runs.
+	MeanIncCI stat.Interval
+	P99IncCI  stat.Interval
+	// P is the p-value of a Mann-Whitney U test of the run means, adjusted
+	// for the number of configs compared against the same baseline.
+	P float64
+	// Significant is true if P is below alpha.
+	Significant bool
+	// MinRuns is the number of runs of each config needed for the test to
+	// be able to reach significance, it's 0 if there are enough runs.
+	MinRuns int
+
+	// minP is the smallest unadjusted p-value possible for the number of
+	// runs of the config and its baseline.
+	minP float64
+}
+
+// compare sets s.Overhead by comparing the runs of s against base.
+func (s *ConfigSummary) compare(base *ConfigSummary, rng *rand.Rand) {
+	baseMeans, baseP99s := base.runValues()
+	means, p99s := s.runValues()
+	_, p := stat.MannWhitneyU(baseMeans, means)
+	s.Overhead = &Overhead{
+		MeanIncCI: incInterval(stat.BootstrapRatio(baseMeans, means, stat.Mean, confidence, resamples, rng)),
+		P99IncCI:  incInterval(stat.BootstrapRatio(baseP99s, p99s, stat.Mean, confidence, resamples, rng)),
+		P:         p,
+		minP:      stat.MinMannWhitneyP(len(baseMeans), len(means)),
+	}
+}
+
+// runValues returns the means and p99s of the runs of s.
+func (s *ConfigSummary) runValues() (means, p99s []float64) {
+	for _, r := range s.Runs {
+		means = append(means, float64(r.Mean))
+		p99s = append(p99s, float64(r.P99))
+	}
+	return means, p99s
+}
+
+// incInterval converts a confidence interval of a ratio into percent.
+func incInterval(ratio stat.Interval) stat.Interval {
+	return stat.Interval{Low: (ratio.Low - 1) * 100, High: (ratio.High - 1) * 100}
+}
+
+// adjustPValues corrects the p-values of the given summaries, which must
+// have been compared against the same baseline, for multiple comparisons and
+// decides their significance. Summaries with too few runs to ever become
+// significant get their MinRuns set instead.
+func adjustPValues(summaries []*ConfigSummary) {
+	ps := make([]float64, len(summaries))
+	for i, s := range summaries {
+		ps[i] = s.Overhead.P
+	}
+	for i, p := range stat.Holm(ps) {
+		o := summaries[i].Overhead
+		o.P = p
+		o.Significant = p < alpha
+		if o.minP*float64(len(summaries)) >= alpha {
+			o.MinRuns = minRuns(len(summaries))
+		}
+	}
+}
+
+// minRuns returns the number of runs of each config needed for the smallest
+// possible p-value of a family of the given number of tests to stay below
+// alpha after the Holm correction.
+func minRuns(tests int) int {
+	n := 2
+	for stat.MinMannWhitneyP(n, n)*float64(tests) >= alpha {
+		n++
+	}
+	return n
+}
+
+// WriteSummary writes a table with the overhead of every config to w.
+func WriteSummary(w io.Writer, table []*ConfigSummary) {
+	tw := tablewriter.NewWriter(w)
+	tw.SetHeader([]string{"Workload", "Concurrency", "Profilers", "Run Mean", "Delta", "95% CI", "Run P99", "Delta", "95% CI", "P"})
+	tw.SetBorder(false)
+	tw.SetCenterSeparator("")
+	tw.SetColumnSeparator("")
+	tw.SetRowSeparator("")
+	tw.SetHeaderLine(false)
+	tw.SetAutoWrapText(false)
+	for _, s := range table {
+		row := []string{
+			s.Workload,
+			fmt.Sprint(s.Concurrency),
+			s.Profilers,
+			internal.TruncateDuration(s.RunMean).String(),
+			"",
+			"",
+			internal.TruncateDuration(s.RunP99).String(),
+			"",
+			"",
+			"",
+		}
+		if o := s.Overhead; o != nil {
+			row[4] = formatInc(s.RunMeanInc)
+			row[5] = formatInterval(o.MeanIncCI)
+			row[7] = formatInc(s.RunP99Inc)
+			row[8] = formatInterval(o.P99IncCI)
+			row[9] = formatP(o, len(s.Runs))
+		}
+		tw.Append(row)
+	}
+	tw.Render()
+}
+
+func formatInc(inc float64) string {
+	return fmt.Sprintf("%+.2f%%", inc)
+}
+
+func formatInterval(i stat.Interval) string {
+	if math.IsNaN(i.Low) {
+		return "n/a"
+	}
+	return fmt.Sprintf("[%+.2f%%, %+.2f%%]", i.Low, i.High)
+}
+
+func formatP(o *Overhead, runs int) string {
+	if o.MinRuns > 0 {
+		return fmt.Sprintf("n/a (n=%d, need %d)", runs, o.MinRuns)
+	}
+	verdict := "~"
+	if o.Significant {
+		verdict = "*"
+	}
+	return fmt.Sprintf("%s (p=%.3f n=%d)", verdict, o.P, runs)
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestMinRuns(t *testing.T) {
+	tests := []struct {
+		tests int
+		want  int
+	}{
+		{1, 4},
+		{6, 5},
+		{7, 6},
+		{23, 6},
+		{24, 7},
+		{85, 7},
+	}
+	for _, tt := range tests {
+		if got := minRuns(tt.tests); got != tt.want {
+			t.Errorf("minRuns(%d): got %d, want %d", tt.tests, got, tt.want)
+		}
+	}
+}
+
+func TestAdjustPValues(t *testing.T) {
+	summary := func(p, minP float64) *ConfigSummary {
+		return &ConfigSummary{Overhead: &Overhead{P: p, minP: minP}}
+	}
+	// 5 runs of each config can reach significance in a family of 2 tests,
+	// 3 runs can't.
+	family := []*ConfigSummary{summary(0.0079, 0.0079), summary(0.1, 0.1)}
+	adjustPValues(family)
+
+	want := []Overhead{
+		{P: 0.0158, Significant: true},
+		{P: 0.1, MinRuns: 5},
+	}
+	for i, s := range family {
+		o, w := s.Overhead, want[i]
+		if !floatEqual(o.P, w.P) || o.Significant != w.Significant || o.MinRuns != w.MinRuns {
+			t.Errorf("%d: got p=%g significant=%t min runs=%d, want p=%g significant=%t min runs=%d",
+				i, o.P, o.Significant, o.MinRuns, w.P, w.Significant, w.MinRuns)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/datadog-go/statsd"
+)
+
+// Sink publishes the results of a report to a monitoring system.
+type Sink interface {
+	Send(table []*ConfigSummary) error
+	Close() error
+}
+
+// Metric is a gauge describing a config of a report.
+type Metric struct {
+	Name  string
+	Value float64
+}
+
+// Labels returns the labels identifying the config of s.
+func (s *ConfigSummary) Labels() [][2]string {
+	return [][2]string{
+		{"profilers", s.Profilers},
+		{"workload", s.Workload},
+		{"concurrency", strconv.Itoa(s.Concurrency)},
+	}
+}
+
+// Metrics returns the gauges published for s. Durations are in seconds and
+// increases in percent.
+func (s *ConfigSummary) Metrics() []Metric {
+	metrics := []Metric{
+		{"ops", float64(s.Ops)},
+		{"mean", s.Mean.Seconds()},
+		{"mean_stdev", s.MeanStdev.Seconds()},
+		{"mean_inc", s.MeanInc},
+		{"p99", s.P99.Seconds()},
+		{"p99_stdev", s.P99Stdev.Seconds()},
+		{"p99_inc", s.P99Inc},
+	}
+	if o := s.Overhead; o != nil && !math.IsNaN(o.MeanIncCI.Low) {
+		metrics = append(metrics,
+			Metric{"mean_inc_low", o.MeanIncCI.Low},
+			Metric{"mean_inc_high", o.MeanIncCI.High},
+			Metric{"p99_inc_low", o.P99IncCI.Low},
+			Metric{"p99_inc_high", o.P99IncCI.High},
+			Metric{"p_value", o.P},
+		)
+	}
+	if s.InstructionsPerOp > 0 {
+		metrics = append(metrics,
+			Metric{"instructions_per_op", s.InstructionsPerOp},
+			Metric{"instructions_per_op_inc", s.InstructionsPerOpInc},
+		)
+	}
+	return metrics
+}
+
+// StatsdSink sends the metrics as gauges to a statsd server.
+type StatsdSink struct {
+	client *statsd.Client
+}
+
+// NewStatsdSink returns a sink sending metrics to the statsd server at addr.
+// The metric names are prefixed with prefix and a dot, and tags are added to
+// every metric in addition to the config labels.
+func NewStatsdSink(addr, prefix string, tags []string) (*StatsdSink, error) {
+	client, err := statsd.New(addr, statsd.WithNamespace(prefix+"."), statsd.WithTags(tags))
+	if err != nil {
+		return nil, err
+	}
+	return &StatsdSink{client: client}, nil
+}
+
+func (s *StatsdSink) Send(table []*ConfigSummary) error {
+	for _, summary := range table {
+		var tags []string
+		for _, l := range summary.Labels() {
+			tags = append(tags, l[0]+":"+l[1])
+		}
+		for _, m := range summary.Metrics() {
+			if err := s.client.Gauge(m.Name, m.Value, tags, 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *StatsdSink) Close() error {
+	return s.client.Close()
+}
+
+// openMetricsContentType is the content type of the OpenMetrics text format.
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// labelValueEscaper escapes label values as required by the OpenMetrics text
+// format, which only knows these three escape sequences.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteOpenMetrics writes the metrics of table to w in the OpenMetrics text
+// format. Metric names are prefixed with prefix and an underscore.
+func WriteOpenMetrics(w io.Writer, prefix string, table []*ConfigSummary) error {
+	type sample struct {
+		labels [][2]string
+		value  float64
+	}
+	families := map[string][]sample{}
+	var names []string
+	for _, s := range table {
+		for _, m := range s.Metrics() {
+			if families[m.Name] == nil {
+				names = append(names, m.Name)
+			}
+			families[m.Name] = append(families[m.Name], sample{s.Labels(), m.Value})
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fullName := prefix + "_" + name
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", fullName)
+		for _, s := range families[name] {
+			var labels []string
+			for _, l := range s.labels {
+				labels = append(labels, l[0]+`="`+labelValueEscaper.Replace(l[1])+`"`)
+			}
+			fmt.Fprintf(&buf, "%s{%s} %s\n", fullName, strings.Join(labels, ","), strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+	buf.WriteString("# EOF\n")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// OpenMetricsFileSink writes the metrics to a file in the OpenMetrics text
+// format, e.g. for the node_exporter textfile collector.
+type OpenMetricsFileSink struct {
+	Path   string
+	Prefix string
+}
+
+func (s *OpenMetricsFileSink) Send(table []*ConfigSummary) error {
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, s.Prefix, table); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Path, buf.Bytes(), 0644)
+}
+
+func (s *OpenMetricsFileSink) Close() error { return nil }
+
+// OpenMetricsHandler serves the metrics of the last report it was sent on
+// /metrics.
+type OpenMetricsHandler struct {
+	Prefix string
+
+	data []byte
+}
+
+func (h *OpenMetricsHandler) Send(table []*ConfigSummary) error {
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, h.Prefix, table); err != nil {
+		return err
+	}
+	h.data = buf.Bytes()
+	return nil
+}
+
+func (h *OpenMetricsHandler) Close() error { return nil }
+
+func (h *OpenMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/metrics" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", openMetricsContentType)
+	w.Write(h.data)
+}
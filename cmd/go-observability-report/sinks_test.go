@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal/stat"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	table := []*ConfigSummary{
+		{
+			Config: Config{Workload: "json", Concurrency: 1, Profilers: "none"},
+			Ops:    100,
+			Mean:   time.Millisecond,
+			P99:    2 * time.Millisecond,
+		},
+		{
+			// Only backslashes, quotes and newlines are escaped in label
+			// values, tabs are written as is.
+			Config:    Config{Workload: "a\\b\"c\nd\te", Concurrency: 8, Profilers: "cpu"},
+			Ops:       90,
+			Mean:      1100 * time.Microsecond,
+			MeanStdev: 100 * time.Microsecond,
+			MeanInc:   10,
+			P99:       2500 * time.Microsecond,
+			P99Inc:    25,
+			Overhead: &Overhead{
+				MeanIncCI: stat.Interval{Low: 5, High: 15},
+				P99IncCI:  stat.Interval{Low: math.Inf(-1), High: 50},
+				P:         0.01,
+			},
+		},
+	}
+	const golden = `# TYPE bench_mean gauge
+bench_mean{profilers="none",workload="json",concurrency="1"} 0.001
+bench_mean{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} 0.0011
+# TYPE bench_mean_inc gauge
+bench_mean_inc{profilers="none",workload="json",concurrency="1"} 0
+bench_mean_inc{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} 10
+# TYPE bench_mean_inc_high gauge
+bench_mean_inc_high{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} 15
+# TYPE bench_mean_inc_low gauge
+bench_mean_inc_low{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} 5
+# TYPE bench_mean_stdev gauge
+bench_mean_stdev{profilers="none",workload="json",concurrency="1"} 0
+bench_mean_stdev{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} 0.0001
+# TYPE bench_ops gauge
+bench_ops{profilers="none",workload="json",concurrency="1"} 100
+bench_ops{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} 90
+# TYPE bench_p99 gauge
+bench_p99{profilers="none",workload="json",concurrency="1"} 0.002
+bench_p99{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} 0.0025
+# TYPE bench_p99_inc gauge
+bench_p99_inc{profilers="none",workload="json",concurrency="1"} 0
+bench_p99_inc{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} 25
+# TYPE bench_p99_inc_high gauge
+bench_p99_inc_high{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} 50
+# TYPE bench_p99_inc_low gauge
+bench_p99_inc_low{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} -Inf
+# TYPE bench_p99_stdev gauge
+bench_p99_stdev{profilers="none",workload="json",concurrency="1"} 0
+bench_p99_stdev{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} 0
+# TYPE bench_p_value gauge
+bench_p_value{profilers="cpu",workload="a\\b\"c\nd<TAB>e",concurrency="8"} 0.01
+# EOF
+`
+	want := strings.ReplaceAll(golden, "<TAB>", "\t")
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, "bench", table); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
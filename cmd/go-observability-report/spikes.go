@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal"
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	// spikeFactor is the multiple of the median latency of the baseline
+	// above which an op that is also slower than the p99 of the baseline is
+	// considered a spike.
+	spikeFactor = 4
+	// maxSpikeEvents is the number of spike events reported per run, the
+	// ones with the highest latency are kept.
+	maxSpikeEvents = 10
+	// minPauseFraction is the fraction of the latency of a spike event that
+	// a pause reported by runtime/metrics needs to reach to be considered
+	// its cause.
+	minPauseFraction = 0.1
+)
+
+// pauseMetrics are the runtime/metrics histograms of stop-the-world pauses
+// and the causes they are attributed to.
+var pauseMetrics = map[string]string{
+	"/sched/pauses/total/gc:seconds":    "gc pause",
+	"/sched/pauses/total/other:seconds": "stw pause",
+}
+
+// SpikeEvent is a period during which one or more ops of a run, possibly on
+// different workers, had a latency spike.
+type SpikeEvent struct {
+	Run   string
+	Start time.Time
+	End   time.Time
+	// Offset is the time from the start of the run to Start.
+	Offset time.Duration
+	Ops    int
+	Max    time.Duration
+	// Causes are the profiler starts and stops and the pauses that overlap
+	// with the event, it's empty if the cause is unknown.
+	Causes []string
+}
+
+// DetectSpikes returns the spike events of the runs in dir that recorded
+// their ops, see detectSpikes. The spike threshold of a run is computed from
+// the runs of its baseline config, the one without profilers and tracing, so
+// that runs without spikes don't report any. Runs without a baseline that
+// recorded its ops are skipped.
+func DetectSpikes(dir string) ([]*SpikeEvent, error) {
+	baselines := map[Config][]time.Duration{}
+	err := internal.ReadMeta(dir, func(meta *internal.RunMeta, opsPath string) error {
+		config := runConfig(meta)
+		if meta.Histogram > 0 || config.Profilers != "none" {
+			return nil
+		}
+		ops, err := readOps(opsPath)
+		if err != nil {
+			return err
+		}
+		for _, op := range ops {
+			if op.Measured() {
+				baselines[config] = append(baselines[config], op.Duration)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	thresholds := map[Config]time.Duration{}
+	for config, durations := range baselines {
+		thresholds[config] = spikeThreshold(durations)
+	}
+
+	var events []*SpikeEvent
+	err = internal.ReadMeta(dir, func(meta *internal.RunMeta, opsPath string) error {
+		baseline := runConfig(meta)
+		baseline.Profilers = "none"
+		threshold, ok := thresholds[baseline]
+		if meta.Histogram > 0 || !ok {
+			return nil
+		}
+		ops, err := readOps(opsPath)
+		if err != nil {
+			return err
+		}
+		samples, err := internal.ReadMetrics(filepath.Join(filepath.Dir(opsPath), internal.MetricsFile))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		events = append(events, detectSpikes(meta, ops, samples, threshold)...)
+		return nil
+	})
+	return events, err
+}
+
+// spikeThreshold returns the latency above which an op is considered a
+// spike, given the latencies of the baseline. It's the larger of spikeFactor
+// times the median and the p99, or 0 if there are no latencies.
+func spikeThreshold(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	threshold := spikeFactor * sorted[len(sorted)/2]
+	if p99 := sorted[len(sorted)*99/100]; p99 > threshold {
+		threshold = p99
+	}
+	return threshold
+}
+
+// detectSpikes merges the overlapping measured ops of a run that are slower
+// than threshold into events and attributes them to the profiler starts and
+// stops and the pauses in samples they overlap with.
+func detectSpikes(meta *internal.RunMeta, ops []internal.RunOp, samples []internal.MetricSample, threshold time.Duration) []*SpikeEvent {
+	var spikes []internal.RunOp
+	for _, op := range ops {
+		if op.Measured() && op.Duration > threshold {
+			spikes = append(spikes, op)
+		}
+	}
+	sort.Slice(spikes, func(i, j int) bool { return spikes[i].Start.Before(spikes[j].Start) })
+
+	var events []*SpikeEvent
+	var cur *SpikeEvent
+	for _, op := range spikes {
+		end := op.Start.Add(op.Duration)
+		if cur == nil || op.Start.After(cur.End) {
+			cur = &SpikeEvent{Run: meta.Name, Start: op.Start, End: end, Offset: op.Start.Sub(meta.RunResult.Start)}
+			events = append(events, cur)
+		} else if end.After(cur.End) {
+			cur.End = end
+		}
+		cur.Ops++
+		if op.Duration > cur.Max {
+			cur.Max = op.Duration
+		}
+	}
+
+	for _, e := range events {
+		e.Causes = spikeCauses(e, meta, samples)
+	}
+	if len(events) > maxSpikeEvents {
+		sort.Slice(events, func(i, j int) bool { return events[i].Max > events[j].Max })
+		events = events[:maxSpikeEvents]
+		sort.Slice(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	}
+	return events
+}
+
+// spikeCauses returns the profiler starts and stops and the pauses that
+// overlap with e.
+func spikeCauses(e *SpikeEvent, meta *internal.RunMeta, samples []internal.MetricSample) []string {
+	overlaps := func(start, end time.Time) bool {
+		return !start.After(e.End) && !end.Before(e.Start)
+	}
+
+	var causes []string
+	for _, p := range meta.Profiles {
+		kind := strings.Split(p.Kind, ".")[0]
+		if overlaps(p.Start, p.Start) {
+			causes = append(causes, kind+" start")
+		}
+		stop := p.Start.Add(p.ProfileDuration)
+		if overlaps(stop, stop.Add(p.StopDuration+p.SinkDuration)) {
+			causes = append(causes, kind+" stop")
+		}
+	}
+
+	// Every sample covers the time since the previous one of the same
+	// metric.
+	prev := map[string]time.Time{}
+	for _, s := range samples {
+		cause, ok := pauseMetrics[s.Name]
+		if !ok {
+			continue
+		}
+		start, ok := prev[s.Name]
+		if !ok {
+			start = s.Time.Add(-meta.MetricsInterval)
+		}
+		prev[s.Name] = s.Time
+		pause := time.Duration(s.Max * float64(time.Second))
+		if s.Count > 0 && float64(pause) >= minPauseFraction*float64(e.Max) && overlaps(start, s.Time) {
+			causes = append(causes, fmt.Sprintf("%s (<%s)", cause, internal.TruncateDuration(pause)))
+		}
+	}
+	return causes
+}
+
+// WriteSpikes writes a table with the spike events to w.
+func WriteSpikes(w io.Writer, events []*SpikeEvent) {
+	tw := tablewriter.NewWriter(w)
+	tw.SetHeader([]string{"Run", "Offset", "Ops", "Max", "Cause"})
+	tw.SetBorder(false)
+	tw.SetCenterSeparator("")
+	tw.SetColumnSeparator("")
+	tw.SetRowSeparator("")
+	tw.SetHeaderLine(false)
+	tw.SetAutoWrapText(false)
+	for _, e := range events {
+		cause := "unknown"
+		if len(e.Causes) > 0 {
+			cause = strings.Join(e.Causes, ", ")
+		}
+		tw.Append([]string{
+			e.Run,
+			internal.TruncateDuration(e.Offset).String(),
+			fmt.Sprint(e.Ops),
+			internal.TruncateDuration(e.Max).String(),
+			cause,
+		})
+	}
+	tw.Render()
+}
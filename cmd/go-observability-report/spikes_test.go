@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felixge/go-observability-bench/internal"
+)
+
+func TestSpikeThreshold(t *testing.T) {
+	ms := time.Millisecond
+	// tail has a p99 of 50ms and a median of 1ms.
+	tail := make([]time.Duration, 100)
+	for i := range tail {
+		tail[i] = ms
+		if i%50 == 0 {
+			tail[i] = 50 * ms
+		}
+	}
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		want      time.Duration
+	}{
+		{"empty", nil, 0},
+		{"factor of the median", []time.Duration{ms, ms, ms, 2 * ms}, 4 * ms},
+		{"p99 above the factor", tail, 50 * ms},
+	}
+	for _, tt := range tests {
+		if got := spikeThreshold(tt.durations); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectSpikes(t *testing.T) {
+	ms := time.Millisecond
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) time.Time { return start.Add(offset) }
+	// ops returns one measured op of 1ms every 10ms for 1s, plus extra.
+	ops := func(extra ...internal.RunOp) []internal.RunOp {
+		var ops []internal.RunOp
+		for i := 0; i < 100; i++ {
+			ops = append(ops, internal.RunOp{Start: at(time.Duration(i) * 10 * ms), Duration: ms})
+		}
+		return append(ops, extra...)
+	}
+	op := func(offset, d time.Duration, worker int) internal.RunOp {
+		return internal.RunOp{Start: at(offset), Duration: d, Worker: worker}
+	}
+
+	tests := []struct {
+		name     string
+		ops      []internal.RunOp
+		profiles []internal.RunProfile
+		samples  []internal.MetricSample
+		// want has one "<offset> <ops> <max> <causes>" line per event.
+		want []string
+	}{
+		{
+			name: "no spikes",
+			ops:  ops(op(500*ms, 4*ms, 1)),
+		},
+		{
+			name: "warmup ops are ignored",
+			ops:  ops(internal.RunOp{Start: at(0), Duration: 50 * ms, Phase: internal.PhaseWarmup}),
+		},
+		{
+			name: "overlapping spikes are merged",
+			ops: ops(
+				op(100*ms, 20*ms, 1),
+				op(110*ms, 30*ms, 2),
+				op(300*ms, 10*ms, 1),
+			),
+			want: []string{
+				"100ms 2 30ms unknown",
+				"300ms 1 10ms unknown",
+			},
+		},
+		{
+			name: "profiler starts and stops",
+			ops: ops(
+				op(95*ms, 20*ms, 1),
+				op(495*ms, 20*ms, 1),
+			),
+			profiles: []internal.RunProfile{
+				{Kind: "cpu.pprof", Start: at(0), ProfileDuration: 100 * ms, StopDuration: ms},
+				{Kind: "cpu.pprof", Start: at(101 * ms), ProfileDuration: 300 * ms, StopDuration: ms},
+			},
+			want: []string{
+				"95ms 1 20ms cpu stop,cpu start",
+				"495ms 1 20ms unknown",
+			},
+		},
+		{
+			name: "pauses",
+			ops: ops(
+				op(205*ms, 20*ms, 1),
+				op(605*ms, 20*ms, 1),
+			),
+			samples: []internal.MetricSample{
+				{Time: at(100 * ms), Name: "/sched/pauses/total/gc:seconds", Count: 1, Max: 0.010},
+				{Time: at(300 * ms), Name: "/sched/pauses/total/gc:seconds", Count: 2, Max: 0.010},
+				{Time: at(300 * ms), Name: "/sched/pauses/total/other:seconds", Count: 1, Max: 0.0001},
+				{Time: at(700 * ms), Name: "/sched/pauses/total/gc:seconds", Count: 1, Max: 0.0001},
+			},
+			want: []string{
+				"205ms 1 20ms gc pause (<10ms)",
+				"605ms 1 20ms unknown",
+			},
+		},
+	}
+	for _, tt := range tests {
+		meta := &internal.RunMeta{
+			RunConfig: internal.RunConfig{Name: "run", MetricsInterval: 100 * ms},
+			RunResult: internal.RunResult{Start: start, Profiles: tt.profiles},
+		}
+		var got []string
+		for _, e := range detectSpikes(meta, tt.ops, tt.samples, 4*ms) {
+			causes := "unknown"
+			if len(e.Causes) > 0 {
+				causes = strings.Join(e.Causes, ",")
+			}
+			got = append(got, fmt.Sprintf("%s %d %s %s", e.Offset, e.Ops, e.Max, causes))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestDetectSpikesMaxEvents(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	var ops []internal.RunOp
+	for i := 0; i < 2*maxSpikeEvents; i++ {
+		ops = append(ops, internal.RunOp{Start: start.Add(time.Duration(i) * time.Second), Duration: time.Duration(i+10) * time.Millisecond})
+	}
+	meta := &internal.RunMeta{RunResult: internal.RunResult{Start: start}}
+	events := detectSpikes(meta, ops, nil, time.Millisecond)
+	if len(events) != maxSpikeEvents {
+		t.Fatalf("got %d events, want %d", len(events), maxSpikeEvents)
+	}
+	for i, e := range events {
+		// The slowest events are kept in the order in which they happened.
+		if want := time.Duration(i+maxSpikeEvents) * time.Second; e.Offset != want {
+			t.Errorf("event %d: got offset %s, want %s", i, e.Offset, want)
+		}
+	}
+}
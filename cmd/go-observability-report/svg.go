@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strings"
+)
+
+// palette is used for the series of a chart.
+var palette = []string{"#4c78a8", "#f58518", "#54a24b", "#e45756", "#72b7b2", "#b279a2", "#eeca3b", "#9d755d", "#bab0ac", "#ff9da6"}
+
+// svgChart renders a simple 2D chart with axes as inline SVG. Values are
+// mapped from the data range given by the x and y fields to the plot area.
+type svgChart struct {
+	width, height float64
+	x, y          axis
+	legend        []legendEntry
+	body          strings.Builder
+}
+
+type axis struct {
+	min, max float64
+	log      bool
+	label    string
+	format   func(float64) string
+}
+
+type legendEntry struct {
+	label string
+	color string
+}
+
+const (
+	marginLeft   = 70
+	marginRight  = 20
+	marginTop    = 20
+	marginBottom = 45
+)
+
+func newSVGChart(width, height float64, x, y axis) *svgChart {
+	if x.max <= x.min {
+		x.max = x.min + 1
+	}
+	if y.max <= y.min {
+		y.max = y.min + 1
+	}
+	return &svgChart{width: width, height: height, x: x, y: y}
+}
+
+// scale maps v from the range of a to [0, 1].
+func (a axis) scale(v float64) float64 {
+	if a.log {
+		return (math.Log10(v) - math.Log10(a.min)) / (math.Log10(a.max) - math.Log10(a.min))
+	}
+	return (v - a.min) / (a.max - a.min)
+}
+
+// ticks returns the positions of the tick marks of a.
+func (a axis) ticks() []float64 {
+	var ticks []float64
+	if a.log {
+		for p := math.Floor(math.Log10(a.min)); p <= math.Ceil(math.Log10(a.max)); p++ {
+			if v := math.Pow(10, p); v >= a.min && v <= a.max {
+				ticks = append(ticks, v)
+			}
+		}
+		if len(ticks) > 1 {
+			return ticks
+		}
+		// Less than one decade, fall back to linear ticks.
+		ticks = nil
+	}
+	step := niceStep((a.max - a.min) / 5)
+	for i := math.Ceil(a.min / step); i*step <= a.max; i++ {
+		// Adding 0 turns -0 into 0.
+		ticks = append(ticks, i*step+0)
+	}
+	return ticks
+}
+
+// niceStep rounds step up to 1, 2 or 5 times a power of ten.
+func niceStep(step float64) float64 {
+	mag := math.Pow(10, math.Floor(math.Log10(step)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*mag >= step {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+func (c *svgChart) px(v float64) float64 {
+	return marginLeft + c.x.scale(v)*(c.width-marginLeft-marginRight)
+}
+
+func (c *svgChart) py(v float64) float64 {
+	return c.height - marginBottom - c.y.scale(v)*(c.height-marginTop-marginBottom)
+}
+
+// Line adds a polyline through points to the chart.
+func (c *svgChart) Line(points [][2]float64, color, label string) {
+	var b strings.Builder
+	for i, p := range points {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%.1f,%.1f", c.px(p[0]), c.py(p[1]))
+	}
+	fmt.Fprintf(&c.body, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, b.String(), color)
+	if label != "" {
+		c.legend = append(c.legend, legendEntry{label: label, color: color})
+	}
+}
+
+// Bar adds a bar from y=0 to y centered at x with the given width in data
+// units, and optionally an error bar from low to high.
+func (c *svgChart) Bar(x, width, y float64, low, high float64, color, title string) {
+	x0, x1 := c.px(x-width/2), c.px(x+width/2)
+	y0, y1 := c.py(0), c.py(y)
+	if y1 > y0 {
+		y0, y1 = y1, y0
+	}
+	fmt.Fprintf(&c.body, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s</title></rect>`,
+		x0, y1, x1-x0, y0-y1, color, html.EscapeString(title))
+	if !math.IsNaN(low) && !math.IsNaN(high) {
+		xm := c.px(x)
+		fmt.Fprintf(&c.body, `<path d="M%.1f,%.1f V%.1f M%.1f,%.1f H%.1f M%.1f,%.1f H%.1f" stroke="#333"/>`,
+			xm, c.py(low), c.py(high),
+			xm-3, c.py(low), xm+3,
+			xm-3, c.py(high), xm+3)
+	}
+}
+
+// VLine adds a vertical line at x.
+func (c *svgChart) VLine(x float64, color, title string) {
+	fmt.Fprintf(&c.body, `<line x1="%.1f" x2="%.1f" y1="%d" y2="%.1f" stroke="%s" stroke-dasharray="4,2"><title>%s</title></line>`,
+		c.px(x), c.px(x), marginTop, c.height-marginBottom, color, html.EscapeString(title))
+}
+
+// Span shades the area between x0 and x1.
+func (c *svgChart) Span(x0, x1 float64, color, title string) {
+	fmt.Fprintf(&c.body, `<rect x="%.1f" y="%d" width="%.1f" height="%.1f" fill="%s" fill-opacity="0.25"><title>%s</title></rect>`,
+		c.px(x0), marginTop, c.px(x1)-c.px(x0), c.height-marginTop-marginBottom, color, html.EscapeString(title))
+}
+
+// XLabel adds a label below the x axis at x, e.g. for bar charts.
+func (c *svgChart) XLabel(x float64, label string) {
+	fmt.Fprintf(&c.body, `<text x="%.1f" y="%.1f" text-anchor="end" transform="rotate(-30 %.1f %.1f)">%s</text>`,
+		c.px(x), c.height-marginBottom+14, c.px(x), c.height-marginBottom+14, html.EscapeString(label))
+}
+
+// SVG returns the chart as an inline SVG element.
+func (c *svgChart) SVG() template.HTML {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" font-size="11" font-family="sans-serif">`, c.width, c.height)
+
+	left, right := float64(marginLeft), c.width-marginRight
+	top, bottom := float64(marginTop), c.height-marginBottom
+	if c.y.format != nil {
+		for _, t := range c.y.ticks() {
+			y := c.py(t)
+			fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%.1f" y2="%.1f" stroke="#eee"/>`, left, right, y, y)
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`, left-4, y, html.EscapeString(c.y.format(t)))
+		}
+	}
+	if c.x.format != nil {
+		for _, t := range c.x.ticks() {
+			x := c.px(t)
+			fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%.1f" y2="%.1f" stroke="#eee"/>`, x, x, top, bottom)
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, x, bottom+14, html.EscapeString(c.x.format(t)))
+		}
+	}
+	fmt.Fprintf(&b, `<path d="M%.1f,%.1f V%.1f H%.1f" fill="none" stroke="#333"/>`, left, top, bottom, right)
+	if c.y.min < 0 && c.y.max > 0 {
+		fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%.1f" y2="%.1f" stroke="#333"/>`, left, right, c.py(0), c.py(0))
+	}
+	fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, (left+right)/2, c.height-6, html.EscapeString(c.x.label))
+	fmt.Fprintf(&b, `<text x="12" y="%.1f" text-anchor="middle" transform="rotate(-90 12 %.1f)">%s</text>`, (top+bottom)/2, (top+bottom)/2, html.EscapeString(c.y.label))
+
+	b.WriteString(c.body.String())
+
+	for i, e := range c.legend {
+		y := top + 4 + float64(i)*14
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="10" height="10" fill="%s"/>`, left+8, y, e.color)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" dominant-baseline="hanging">%s</text>`, left+22, y, html.EscapeString(e.label))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
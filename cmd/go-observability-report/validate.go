@@ -0,0 +1,190 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/felixge/go-observability-bench/internal"
+	"github.com/felixge/go-observability-bench/workload"
+	"github.com/olekukonko/tablewriter"
+)
+
+const validateUsage = "usage: go-observability-report validate [-max-error <pp>] <outdir>"
+
+// Validation compares the fraction of a profile attributed to a function
+// against the ground truth of the workload.
+type Validation struct {
+	Run      string
+	Profile  string
+	Function string
+	// Expected and Actual are fractions of the values attributed to the
+	// functions of the ground truth, Error is their absolute difference in
+	// percentage points. Actual and Error are NaN if the profiles contain
+	// none of the functions.
+	Expected float64
+	Actual   float64
+	Error    float64
+	Value    int64
+}
+
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	maxErrorF := fs.Float64("max-error", 5, "Max error in percentage points before validation fails")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("error: expected one outdir (%s)", validateUsage)
+	}
+
+	validations, skipped, err := Validate(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, s := range skipped {
+		fmt.Fprintf(os.Stderr, "warning: skipped %s\n", s)
+	}
+	if len(validations) == 0 {
+		return fmt.Errorf("no profiles of workloads with a ground truth found in %s", fs.Arg(0))
+	}
+	WriteValidations(os.Stdout, validations, *maxErrorF)
+
+	var failed int
+	for _, v := range validations {
+		if !(v.Error <= *maxErrorF) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d functions exceeded the max error of %.2fpp", failed, len(validations), *maxErrorF)
+	}
+	return nil
+}
+
+// Validate compares the pprof profiles of the runs in dir against the ground
+// truth of their workloads. The values of all profiles of the same kind
+// within a run are added up. Runs with pprof profiles that can't be
+// validated, e.g. because their workload is unknown to this build or has no
+// ground truth, are skipped and returned as "<run>: <reason>".
+func Validate(dir string) ([]*Validation, []string, error) {
+	var (
+		validations []*Validation
+		skipped     []string
+	)
+	err := internal.ReadMeta(dir, func(meta *internal.RunMeta, opsPath string) error {
+		files := map[string][]string{}
+		var kinds []string
+		for _, p := range meta.Profiles {
+			if p.File == "" || p.Error != "" || !strings.HasSuffix(p.File, ".pprof") {
+				continue
+			}
+			kind := strings.Split(p.File, ".")[0]
+			if files[kind] == nil {
+				kinds = append(kinds, kind)
+			}
+			files[kind] = append(files[kind], filepath.Join(filepath.Dir(opsPath), p.File))
+		}
+		sort.Strings(kinds)
+		if len(kinds) == 0 {
+			return nil
+		}
+
+		w, err := workload.New(meta.Workload, []byte(meta.Args))
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %s", meta.Name, err))
+			return nil
+		}
+		v, ok := w.(workload.Validatable)
+		if !ok {
+			skipped = append(skipped, fmt.Sprintf("%s: workload %s has no ground truth", meta.Name, meta.Workload))
+			return nil
+		}
+		var validated bool
+		for _, kind := range kinds {
+			truth := v.GroundTruth(kind)
+			if truth == nil {
+				continue
+			}
+			validated = true
+			values := map[string]int64{}
+			for _, path := range files[kind] {
+				fileValues, _, err := internal.FunctionValues(path, truth.SampleType)
+				if err != nil {
+					return err
+				}
+				for fn, val := range fileValues {
+					values[fn] += val
+				}
+			}
+			validations = append(validations, validateKind(meta.Name, kind, truth, values)...)
+		}
+		if !validated {
+			skipped = append(skipped, fmt.Sprintf("%s: workload %s has no ground truth for %s", meta.Name, meta.Workload, strings.Join(kinds, ", ")))
+		}
+		return nil
+	})
+	return validations, skipped, err
+}
+
+// validateKind compares values against truth.
+func validateKind(run, kind string, truth *workload.GroundTruth, values map[string]int64) []*Validation {
+	var total int64
+	for fn := range truth.Fractions {
+		total += values[fn]
+	}
+	var validations []*Validation
+	for fn, expected := range truth.Fractions {
+		actual := math.NaN()
+		if total > 0 {
+			actual = float64(values[fn]) / float64(total)
+		}
+		validations = append(validations, &Validation{
+			Run:      run,
+			Profile:  kind,
+			Function: fn,
+			Expected: expected,
+			Actual:   actual,
+			Error:    math.Abs(actual-expected) * 100,
+			Value:    values[fn],
+		})
+	}
+	sort.Slice(validations, func(i, j int) bool { return validations[i].Function < validations[j].Function })
+	return validations
+}
+
+// WriteValidations writes a table with the validations to w, marking the
+// ones with an error above maxError.
+func WriteValidations(w io.Writer, validations []*Validation, maxError float64) {
+	tw := tablewriter.NewWriter(w)
+	tw.SetHeader([]string{"Run", "Profile", "Function", "Value", "Expected", "Actual", "Error"})
+	tw.SetBorder(false)
+	tw.SetCenterSeparator("")
+	tw.SetColumnSeparator("")
+	tw.SetRowSeparator("")
+	tw.SetHeaderLine(false)
+	tw.SetAutoWrapText(false)
+	for _, v := range validations {
+		actual, errStr := "n/a", "n/a FAIL"
+		if !math.IsNaN(v.Actual) {
+			actual = fmt.Sprintf("%.2f%%", v.Actual*100)
+			errStr = fmt.Sprintf("%.2fpp", v.Error)
+			if v.Error > maxError {
+				errStr += " FAIL"
+			}
+		}
+		tw.Append([]string{
+			v.Run,
+			v.Profile,
+			v.Function[strings.LastIndex(v.Function, "/")+1:],
+			fmt.Sprint(v.Value),
+			fmt.Sprintf("%.2f%%", v.Expected*100),
+			actual,
+			errStr,
+		})
+	}
+	tw.Render()
+}
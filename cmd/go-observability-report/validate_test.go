@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felixge/go-observability-bench/internal"
+	"github.com/felixge/go-observability-bench/workload"
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidateKind(t *testing.T) {
+	truth := &workload.GroundTruth{
+		SampleType: "cpu",
+		Fractions:  map[string]float64{"a": 0.25, "b": 0.75},
+	}
+	tests := []struct {
+		name   string
+		values map[string]int64
+		// actual and errs are by function, NaN if the function can't be
+		// validated.
+		actual map[string]float64
+		errs   map[string]float64
+	}{
+		{
+			name:   "exact",
+			values: map[string]int64{"a": 25, "b": 75},
+			actual: map[string]float64{"a": 0.25, "b": 0.75},
+			errs:   map[string]float64{"a": 0, "b": 0},
+		},
+		{
+			name:   "off",
+			values: map[string]int64{"a": 50, "b": 50},
+			actual: map[string]float64{"a": 0.5, "b": 0.5},
+			errs:   map[string]float64{"a": 25, "b": 25},
+		},
+		{
+			name:   "other functions are ignored",
+			values: map[string]int64{"a": 1, "b": 3, "c": 1000},
+			actual: map[string]float64{"a": 0.25, "b": 0.75},
+			errs:   map[string]float64{"a": 0, "b": 0},
+		},
+		{
+			name:   "missing function",
+			values: map[string]int64{"b": 10},
+			actual: map[string]float64{"a": 0, "b": 1},
+			errs:   map[string]float64{"a": 25, "b": 25},
+		},
+		{
+			name:   "no values",
+			values: map[string]int64{},
+			actual: map[string]float64{"a": math.NaN(), "b": math.NaN()},
+			errs:   map[string]float64{"a": math.NaN(), "b": math.NaN()},
+		},
+	}
+	for _, tt := range tests {
+		validations := validateKind("run", "cpu", truth, tt.values)
+		if len(validations) != 2 || validations[0].Function != "a" || validations[1].Function != "b" {
+			t.Errorf("%s: got %d validations, want a and b", tt.name, len(validations))
+			continue
+		}
+		for _, v := range validations {
+			if v.Run != "run" || v.Profile != "cpu" || v.Expected != truth.Fractions[v.Function] || v.Value != tt.values[v.Function] {
+				t.Errorf("%s: %s: got %+v", tt.name, v.Function, v)
+			}
+			if !floatEqual(v.Actual, tt.actual[v.Function]) {
+				t.Errorf("%s: %s: got actual %v, want %v", tt.name, v.Function, v.Actual, tt.actual[v.Function])
+			}
+			if !floatEqual(v.Error, tt.errs[v.Function]) {
+				t.Errorf("%s: %s: got error %v, want %v", tt.name, v.Function, v.Error, tt.errs[v.Function])
+			}
+		}
+	}
+}
+
+// floatEqual returns true if a and b are within 1e-9 of each other or both
+// NaN.
+func floatEqual(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestValidateSkipped(t *testing.T) {
+	dir := t.TempDir()
+	runs := []internal.RunConfig{
+		{Name: "gone", Workload: "gone"},
+		{Name: "json", Workload: "json", Args: "{}\n"},
+		{Name: "baseline", Workload: "gone"},
+	}
+	for _, rc := range runs {
+		meta := &internal.RunMeta{RunConfig: rc}
+		if rc.Name != "baseline" {
+			meta.Profiles = []internal.RunProfile{{Kind: "cpu", File: "cpu.0.pprof"}}
+		}
+		data, err := yaml.Marshal(meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runDir := filepath.Join(dir, rc.Name)
+		if err := os.Mkdir(runDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(runDir, "meta.yaml"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	validations, skipped, err := Validate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(validations) != 0 {
+		t.Errorf("got %d validations, want 0", len(validations))
+	}
+	got := strings.Join(skipped, "\n")
+	want := strings.Join([]string{
+		`gone: unknown workload: "gone"`,
+		"json: workload json has no ground truth",
+	}, "\n")
+	if got != want {
+		t.Errorf("got skipped:\n%s\nwant:\n%s", got, want)
+	}
+}
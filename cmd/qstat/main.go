@@ -1,13 +1,11 @@
 package main
 
 import (
-	"bytes"
-	"encoding/csv"
 	"flag"
 	"fmt"
-	"io"
+	"io/ioutil"
+	"math"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -15,6 +13,7 @@ import (
 	"time"
 
 	"github.com/felixge/go-observability-bench/internal"
+	"github.com/felixge/go-observability-bench/internal/stat"
 	"github.com/olekukonko/tablewriter"
 )
 
@@ -52,7 +51,7 @@ func run() error {
 	}
 
 	outRows := outRows(allRows)
-	order := []string{"none", "cpu", "mem", "mutex", "block", "goroutine", "trace", "all"}
+	order := []string{"none", "cpu", "mem", "mutex", "block", "goroutine", "trace", "datadog", "all"}
 	for workload, rows := range outRows {
 		sort.Slice(rows, func(i, j int) bool {
 			io := stringIndex(rows[i].Profiler, order)
@@ -72,12 +71,8 @@ func run() error {
 		tw.SetRowSeparator("")
 		tw.SetHeaderLine(false)
 		for _, r := range rows {
-			profiler := r.Profiler
-			if profiler == "cpu+mem+block+mutex+goroutine+trace" {
-				profiler = "all"
-			}
 			tw.Append([]string{
-				profiler,
+				r.Profiler,
 				r.Concurrency,
 				internal.TruncateDuration(r.NoneMean).String(),
 				r.NoneDev,
@@ -138,55 +133,84 @@ func profilerName(txtPath string) string {
 	return strings.TrimSuffix(filepath.Base(txtPath), ".txt")
 }
 
+// benchStat compares the ns/op of the benchmarks in the before and after
+// files, similar to benchstat.
 func benchStat(before, after string) ([]*bsRow, error) {
-	buf := &bytes.Buffer{}
-	cmd := exec.Command("benchstat", "-csv", before, after)
-	cmd.Stdout = buf
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	names, noneVals, err := readGoBench(before)
+	if err != nil {
 		return nil, err
 	}
+	_, afterVals, err := readGoBench(after)
+	if err != nil {
+		return nil, err
+	}
+
+	// Runs with every pprof profiler and no profile name are labeled with
+	// all of them joined by "+", after the tracing if there is any.
+	profiler := strings.Replace(profilerName(after), "cpu+mem+block+mutex+goroutine+trace", "all", 1)
+
 	var rows []*bsRow
-	cr := csv.NewReader(buf)
-	for header := true; ; header = false {
-		record, err := cr.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, err
-		} else if header {
+	for _, name := range names {
+		afterSamples, ok := afterVals[name]
+		if !ok {
 			continue
 		}
+		noneSamples := noneVals[name]
+		noneMean, afterMean := stat.Mean(noneSamples), stat.Mean(afterSamples)
+		_, p := stat.MannWhitneyU(noneSamples, afterSamples)
+		delta := "~"
+		if p < 0.05 {
+			delta = fmt.Sprintf("%+.2f%%", (afterMean/noneMean-1)*100)
+		}
+		wc := strings.Split(strings.TrimPrefix(name, "Benchmark"), "_C")
+		rows = append(rows, &bsRow{
+			Profiler:    profiler,
+			Workload:    wc[0],
+			Concurrency: wc[1],
+			None:        time.Duration(noneMean),
+			NoneDev:     rangeDev(noneSamples, noneMean),
+			After:       time.Duration(afterMean),
+			AfterDev:    rangeDev(afterSamples, afterMean),
+			Delta:       delta,
+			PVal:        fmt.Sprintf("(p=%.3f n=%d+%d)", p, len(noneSamples), len(afterSamples)),
+		})
+	}
+	return rows, nil
+}
 
-		noneVal, err := strconv.ParseFloat(record[1], 64)
-		if err != nil {
-			return nil, err
+// readGoBench reads the ns/op values of a file written by
+// go-observability-report. The names are returned in the order of the file.
+func readGoBench(path string) ([]string, map[string][]float64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	vals := map[string][]float64{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[3] != "ns/op" {
+			continue
 		}
-		afterVal, err := strconv.ParseFloat(record[3], 64)
+		val, err := strconv.ParseFloat(fields[2], 64)
 		if err != nil {
-			return nil, err
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
 		}
-		wc := strings.Split(record[0], "_C")
-
-		profiler := profilerName(after)
-		if profiler == "cpu+mem+block+mutex+goroutine+trace" {
-			profiler = "all"
+		if _, ok := vals[fields[0]]; !ok {
+			names = append(names, fields[0])
 		}
+		vals[fields[0]] = append(vals[fields[0]], val)
+	}
+	return names, vals, nil
+}
 
-		row := &bsRow{
-			Profiler:    profiler,
-			Workload:    wc[0],
-			Concurrency: wc[1],
-			None:        time.Duration(noneVal),
-			NoneDev:     record[2],
-			After:       time.Duration(afterVal),
-			AfterDev:    record[4],
-			Delta:       record[5],
-			PVal:        record[6],
-		}
-		rows = append(rows, row)
+// rangeDev returns the largest deviation of vals from mean in percent.
+func rangeDev(vals []float64, mean float64) string {
+	var dev float64
+	for _, v := range vals {
+		dev = math.Max(dev, math.Abs(v-mean))
 	}
-	return rows, nil
+	return fmt.Sprintf("±%.0f%%", dev/mean*100)
 }
 
 type bsRow struct {
@@ -1,7 +1,9 @@
 package internal
 
 import (
+	"fmt"
 	"io/ioutil"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -12,26 +14,63 @@ func ReadConfig(path string) (c Config, err error) {
 	if err != nil {
 		return c, err
 	}
-	err = yaml.Unmarshal(data, &c)
+	if err = yaml.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.ResolveProfiles(); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
 	c.setDefaults()
-	return
+	return c, nil
 }
 
 type Config struct {
 	Repeat int
-	Jobs   []JobConfig `yaml:"jobs"`
+	// Schedule controls the order in which runs are executed, see
+	// ScheduleSequential, ScheduleRoundRobin and ScheduleRandom.
+	Schedule string `yaml:"schedule"`
+	// Seed is used by ScheduleRandom. A random seed is picked if it's 0.
+	Seed int64 `yaml:"seed"`
+	// Profiles defines named profile sets that can be referenced by name
+	// from the profiles of jobs and other profile sets. They take precedence
+	// over BuiltinProfiles.
+	Profiles map[string]ProfileSet `yaml:"profiles"`
+	Jobs     []JobConfig           `yaml:"jobs"`
 }
 
+const (
+	// ScheduleSequential executes runs in the order in which they are
+	// declared.
+	ScheduleSequential = "sequential"
+	// ScheduleRoundRobin rotates the profile and tracing configs of the runs
+	// that are compared to each other by one position per iteration, so
+	// each of them is affected by drift within an iteration equally.
+	ScheduleRoundRobin = "round-robin"
+	// ScheduleRandom shuffles the runs.
+	ScheduleRandom = "random"
+)
+
 func (c *Config) setDefaults() {
 	if c.Repeat == 0 {
 		c.Repeat = 1
 	}
+	if c.Schedule == "" {
+		c.Schedule = ScheduleSequential
+	}
 	for jIdx := range c.Jobs {
 		j := &c.Jobs[jIdx]
 		if len(j.Concurrency) == 0 {
 			j.Concurrency = append(j.Concurrency, 1)
 		}
 
+		if j.Rate > 0 && j.Arrival == "" {
+			j.Arrival = ArrivalConstant
+		}
+
+		if len(j.Tracing) == 0 {
+			j.Tracing = append(j.Tracing, TracingNone)
+		}
+
 		if len(j.Profile) == 0 {
 			j.Profile = append(j.Profile, ProfileConfig{})
 		}
@@ -46,7 +85,8 @@ func (c *Config) setDefaults() {
 			}
 		}
 
-		// Note: profile.Period defaults to the Job's duration, see
+		// Note: profile.Period defaults to the Job's duration and
+		// profile.DatadogCPUDuration to a quarter of the period, see
 		// Coordinator.runConfigs().
 	}
 }
@@ -57,9 +97,235 @@ type JobConfig struct {
 	Concurrency []int           `yaml:"concurrency"`
 	Duration    []time.Duration `yaml:"duration"`
 	Profile     []ProfileConfig `yaml:"profile"`
-	Args        []yaml.Node     `yaml:"args"`
+	// Tracing lists the tracers to run the workloads with, see
+	// TracingNone, TracingDatadog and TracingOpenTelemetry.
+	Tracing []string    `yaml:"tracing"`
+	Args    []yaml.Node `yaml:"args"`
+	// Rate switches the workers from running ops back to back to starting
+	// them at the given rate (ops/s) with latencies measured from the
+	// intended start time of every op, see ArrivalConstant and
+	// ArrivalPoisson.
+	Rate    float64 `yaml:"rate"`
+	Arrival string  `yaml:"arrival"`
+	// Histogram records op latencies into a histogram with the given number
+	// of significant digits (1-5) instead of writing every op to ops.csv.
+	// Every worker keeps its own histogram, which takes about 170 KiB with
+	// 3 digits and latencies up to 1s, growing roughly 8x with every
+	// additional digit to about 14 MiB with 5 digits, see NewHistogram. 3
+	// digits are enough for most runs.
+	Histogram int `yaml:"histogram"`
+	// Warmup and Cooldown are executed before and after the measured
+	// duration of every run. Their ops are tagged with PhaseWarmup and
+	// PhaseCooldown and excluded from the results, profiling only starts
+	// after the warmup.
+	Warmup   time.Duration `yaml:"warmup"`
+	Cooldown time.Duration `yaml:"cooldown"`
+	// MetricsInterval enables sampling all runtime/metrics at the given
+	// interval during the measured duration of every run. The samples are
+	// written to MetricsFile.
+	MetricsInterval time.Duration `yaml:"metrics_interval"`
+	// PerfCounters enables counting hardware events via perf_event_open(2)
+	// during the measured duration of every run. Runs on hosts that don't
+	// permit it record the error instead of failing.
+	PerfCounters bool `yaml:"perf_counters"`
+	// CPUQuota and MemoryLimit run every `_run` child in a cgroup v2 limiting
+	// it to the given number of CPUs (e.g. 0.5) and bytes of memory.
+	CPUQuota    float64 `yaml:"cpu_quota"`
+	MemoryLimit int64   `yaml:"memory_limit"`
+	// Exclude removes the combinations matching any of its rules from the
+	// matrix of the job. Include adds the combinations of its rules after
+	// that, with unset fields taking all values of the job. Like the
+	// matrix of CI systems, includes are not affected by excludes.
+	Exclude []MatrixRule `yaml:"exclude"`
+	Include []MatrixRule `yaml:"include"`
+	// WorkloadArgs overrides the given args for a single workload, e.g. to
+	// only pass a json_file to the json workload. Nested mappings are
+	// merged key by key.
+	WorkloadArgs map[string]yaml.Node `yaml:"workload_args"`
+}
+
+// MatrixRule matches combinations of the matrix of a job. Unset fields match
+// any value.
+type MatrixRule struct {
+	Workload    string        `yaml:"workload"`
+	Concurrency int           `yaml:"concurrency"`
+	Duration    time.Duration `yaml:"duration"`
+	// Profilers matches a profile by its label, e.g. "cpu,mem", "none" or
+	// the name of a profile set, see ProfileConfig.Label.
+	Profilers string `yaml:"profilers"`
+	Tracing   string `yaml:"tracing"`
 }
 
+// IsZero returns true if r has no fields set.
+func (r MatrixRule) IsZero() bool {
+	return r == MatrixRule{}
+}
+
+// Matches returns true if all fields of r that are set match e.
+func (r MatrixRule) Matches(e MatrixEntry) bool {
+	return (r.Workload == "" || r.Workload == e.Workload) &&
+		(r.Concurrency == 0 || r.Concurrency == e.Concurrency) &&
+		(r.Duration == 0 || r.Duration == e.Duration) &&
+		(r.Profilers == "" || r.Profilers == e.Profile.Label()) &&
+		(r.Tracing == "" || r.Tracing == e.Tracing)
+}
+
+// MatrixEntry is a combination of the matrix of a job. It's executed once
+// for every args of the job.
+type MatrixEntry struct {
+	Workload    string
+	Concurrency int
+	Duration    time.Duration
+	Profile     ProfileConfig
+	Tracing     string
+}
+
+// Matrix returns the combinations of workload, concurrency, duration,
+// profile and tracing executed by the job, see Include and Exclude.
+func (j JobConfig) Matrix() []MatrixEntry {
+	var entries []MatrixEntry
+	seen := map[MatrixEntry]bool{}
+	add := func(e MatrixEntry) {
+		if !seen[e] {
+			seen[e] = true
+			entries = append(entries, e)
+		}
+	}
+
+	product := func(r MatrixRule, cb func(MatrixEntry)) {
+		workloads, concurrencies, durations, tracings := j.Workload, j.Concurrency, j.Duration, j.Tracing
+		if r.Workload != "" {
+			workloads = []string{r.Workload}
+		}
+		if r.Concurrency != 0 {
+			concurrencies = []int{r.Concurrency}
+		}
+		if r.Duration != 0 {
+			durations = []time.Duration{r.Duration}
+		}
+		if r.Tracing != "" {
+			tracings = []string{r.Tracing}
+		}
+		for _, workload := range workloads {
+			for _, concurrency := range concurrencies {
+				for _, duration := range durations {
+					for _, profile := range j.Profile {
+						if r.Profilers != "" && r.Profilers != profile.Label() {
+							continue
+						}
+						for _, tracing := range tracings {
+							cb(MatrixEntry{
+								Workload:    workload,
+								Concurrency: concurrency,
+								Duration:    duration,
+								Profile:     profile,
+								Tracing:     tracing,
+							})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	product(MatrixRule{}, func(e MatrixEntry) {
+		for _, r := range j.Exclude {
+			if r.Matches(e) {
+				return
+			}
+		}
+		add(e)
+	})
+	for _, r := range j.Include {
+		product(r, add)
+	}
+	return entries
+}
+
+// ArgsFor returns the args of the job for the given workload, with its
+// WorkloadArgs merged into each of them.
+func (j JobConfig) ArgsFor(workload string) []yaml.Node {
+	override, ok := j.WorkloadArgs[workload]
+	if !ok {
+		return j.Args
+	}
+	args := make([]yaml.Node, len(j.Args))
+	for i := range j.Args {
+		args[i] = mergeMappings(&j.Args[i], &override)
+	}
+	return args
+}
+
+// mergeMappings returns a mapping with the keys of base and override, with
+// the values of override taking precedence. Values that are mappings in both
+// are merged recursively. base is returned unmodified if either of them is
+// not a mapping.
+func mergeMappings(base, override *yaml.Node) yaml.Node {
+	base, override = resolveAlias(base), resolveAlias(override)
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return *base
+	}
+	overrides := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		overrides[override.Content[i].Value] = override.Content[i+1]
+	}
+	merged := *base
+	merged.Content = nil
+	nested := map[string]bool{}
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		key, val := base.Content[i], base.Content[i+1]
+		o, ok := overrides[key.Value]
+		if !ok {
+			merged.Content = append(merged.Content, key, val)
+		} else if resolveAlias(val).Kind == yaml.MappingNode && resolveAlias(o).Kind == yaml.MappingNode {
+			m := mergeMappings(val, o)
+			merged.Content = append(merged.Content, key, &m)
+			nested[key.Value] = true
+		}
+	}
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		if !nested[override.Content[i].Value] {
+			merged.Content = append(merged.Content, override.Content[i], override.Content[i+1])
+		}
+	}
+	return merged
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	if n.Kind == yaml.AliasNode {
+		return n.Alias
+	}
+	return n
+}
+
+const (
+	// ArrivalConstant starts ops at fixed intervals.
+	ArrivalConstant = "constant"
+	// ArrivalPoisson starts ops at exponentially distributed intervals.
+	ArrivalPoisson = "poisson"
+)
+
+const (
+	// TracingNone disables tracing.
+	TracingNone = "none"
+	// TracingDatadog wraps every op in a dd-trace-go span and enables the
+	// dd-trace-go integrations of the workload.
+	TracingDatadog = "datadog"
+	// TracingOpenTelemetry wraps every op in an OpenTelemetry SDK span,
+	// records per-op metrics and enables the otelhttp integration.
+	TracingOpenTelemetry = "otel"
+)
+
+const (
+	// ProfileSinkDisk writes profiles to the outdir of the run.
+	ProfileSinkDisk = "disk"
+	// ProfileSinkDiscard drops profiles after they were collected.
+	ProfileSinkDiscard = "discard"
+	// ProfileSinkHTTP uploads profiles to a fake agent running inside of
+	// the benchmark process.
+	ProfileSinkHTTP = "http"
+)
+
 type ProfileConfig struct {
 	Period    time.Duration `yaml:"period"`
 	CPU       bool          `yaml:"cpu"`
@@ -71,6 +337,130 @@ type ProfileConfig struct {
 	MutexRate int           `yaml:"mutex_rate"`
 	Goroutine bool          `yaml:"goroutine"`
 	Trace     bool          `yaml:"trace"`
+	// Datadog enables the dd-trace-go continuous profiler, uploading to a
+	// fake agent running inside of the benchmark process.
+	Datadog            bool          `yaml:"datadog"`
+	DatadogCPUDuration time.Duration `yaml:"datadog_cpu_duration"`
+	// Sink is where profiles are shipped to when they are stopped, see
+	// ProfileSinkDisk, ProfileSinkDiscard and ProfileSinkHTTP.
+	Sink string `yaml:"sink"`
+	// Name labels the profile in run names and reports instead of its
+	// profilers. It's set to the name of the profile set a profile was
+	// referenced by.
+	Name string `yaml:"name,omitempty"`
+
+	// ref is the name of the profile set this profile was given as in yaml,
+	// it's replaced by the profiles of the set by Config.ResolveProfiles.
+	ref string
+}
+
+func (p *ProfileConfig) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode && n.Tag != "!!null" {
+		p.ref = n.Value
+		return nil
+	}
+	type plain ProfileConfig
+	return n.Decode((*plain)(p))
+}
+
+// ProfileSet is a named list of profiles. In yaml it can also be given as a
+// single profile.
+type ProfileSet []ProfileConfig
+
+func (s *ProfileSet) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.SequenceNode {
+		return n.Decode((*[]ProfileConfig)(s))
+	}
+	var p ProfileConfig
+	if err := n.Decode(&p); err != nil {
+		return err
+	}
+	*s = ProfileSet{p}
+	return nil
+}
+
+// BuiltinProfiles are the profile sets available to every config. They
+// mirror common production setups.
+var BuiltinProfiles = map[string]ProfileSet{
+	"baseline":  {{}},
+	"cpu":       {{Name: "cpu", CPU: true}},
+	"mem":       {{Name: "mem", Mem: true}},
+	"block":     {{Name: "block", Block: true}},
+	"mutex":     {{Name: "mutex", Mutex: true}},
+	"goroutine": {{Name: "goroutine", Goroutine: true}},
+	"trace":     {{Name: "trace", Trace: true}},
+	// cpu-mem is what most continuous profilers collect by default.
+	"cpu-mem":   {{Name: "cpu-mem", CPU: true, Mem: true}},
+	"all-pprof": {{Name: "all-pprof", CPU: true, Mem: true, Block: true, Mutex: true, Goroutine: true}},
+	// dd-default is the dd-trace-go profiler with its default profile
+	// types.
+	"dd-default": {{Name: "dd-default", Datadog: true}},
+	// common compares the setups above against the baseline.
+	"common": {{ref: "baseline"}, {ref: "cpu-mem"}, {ref: "all-pprof"}, {ref: "dd-default"}},
+}
+
+// profileSet returns the profile set with the given name.
+func (c *Config) profileSet(name string) (ProfileSet, bool) {
+	if set, ok := c.Profiles[name]; ok {
+		return set, true
+	}
+	set, ok := BuiltinProfiles[name]
+	return set, ok
+}
+
+// ResolveProfiles replaces the references to profile sets in the profiles of
+// all jobs with the profiles of the sets.
+func (c *Config) ResolveProfiles() error {
+	for i := range c.Jobs {
+		profiles, err := c.resolve(c.Jobs[i].Profile, nil)
+		if err != nil {
+			return fmt.Errorf("jobs[%d].profile: %w", i, err)
+		}
+		c.Jobs[i].Profile = profiles
+	}
+	return nil
+}
+
+// resolve returns profiles with references replaced by the profiles of the
+// set they reference. stack holds the names of the sets being resolved.
+func (c *Config) resolve(profiles []ProfileConfig, stack []string) ([]ProfileConfig, error) {
+	var resolved []ProfileConfig
+	for _, p := range profiles {
+		if p.ref == "" {
+			resolved = append(resolved, p)
+			continue
+		}
+		for _, name := range stack {
+			if name == p.ref {
+				return nil, fmt.Errorf("profile set %q references itself", p.ref)
+			}
+		}
+		set, ok := c.profileSet(p.ref)
+		if !ok {
+			return nil, fmt.Errorf("unknown profile set %q", p.ref)
+		}
+		profiles, err := c.resolve(set, append(stack, p.ref))
+		if err != nil {
+			return nil, err
+		}
+		// A set with a single unnamed profile is named after the set.
+		if len(set) == 1 && set[0].ref == "" && set[0].Name == "" {
+			profiles[0].Name = p.ref
+		}
+		resolved = append(resolved, profiles...)
+	}
+	return resolved, nil
+}
+
+// Label returns the name of the profile, or its profilers joined by commas
+// if it has none. Profiles without profilers are always labeled "none", so
+// they can be recognized as the baseline.
+func (p ProfileConfig) Label() string {
+	profilers := strings.Join(p.Profilers(), ",")
+	if p.Name == "" || profilers == "none" {
+		return profilers
+	}
+	return p.Name
 }
 
 func (p ProfileConfig) Profilers() []string {
@@ -93,6 +483,9 @@ func (p ProfileConfig) Profilers() []string {
 	if p.Trace {
 		profilers = append(profilers, "trace")
 	}
+	if p.Datadog {
+		profilers = append(profilers, "datadog")
+	}
 	if len(profilers) == 0 {
 		profilers = append(profilers, "none")
 	}
@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseConfig parses config like ReadConfig.
+func parseConfig(t *testing.T, config string) Config {
+	t.Helper()
+	var c Config
+	if err := yaml.Unmarshal([]byte(config), &c); err != nil {
+		t.Fatal(err)
+	} else if err := c.ResolveProfiles(); err != nil {
+		t.Fatal(err)
+	}
+	c.setDefaults()
+	return c
+}
+
+// parseJob returns the first job of the given config.
+func parseJob(t *testing.T, config string) JobConfig {
+	t.Helper()
+	return parseConfig(t, config).Jobs[0]
+}
+
+func TestMatrix(t *testing.T) {
+	const job = `
+jobs:
+  - workload: [json, sql]
+    concurrency: [1, 8]
+    duration: [1s]
+    profile: [{}, {cpu: true}]
+`
+	tests := []struct {
+		name  string
+		rules string
+		want  []string
+	}{
+		{
+			name: "full product",
+			want: []string{
+				"json/1/none", "json/1/cpu", "json/8/none", "json/8/cpu",
+				"sql/1/none", "sql/1/cpu", "sql/8/none", "sql/8/cpu",
+			},
+		},
+		{
+			name: "exclude",
+			rules: `
+    exclude:
+      - {workload: sql, concurrency: 1}
+      - {profilers: cpu, concurrency: 8}
+`,
+			want: []string{"json/1/none", "json/1/cpu", "json/8/none", "sql/8/none"},
+		},
+		{
+			name: "exclude then include",
+			rules: `
+    exclude:
+      - {workload: sql}
+    include:
+      - {workload: sql, concurrency: 8, profilers: none}
+`,
+			want: []string{"json/1/none", "json/1/cpu", "json/8/none", "json/8/cpu", "sql/8/none"},
+		},
+		{
+			name: "include outside of the product",
+			rules: `
+    include:
+      - {workload: http, concurrency: 32}
+`,
+			want: []string{
+				"json/1/none", "json/1/cpu", "json/8/none", "json/8/cpu",
+				"sql/1/none", "sql/1/cpu", "sql/8/none", "sql/8/cpu",
+				"http/32/none", "http/32/cpu",
+			},
+		},
+		{
+			name: "duplicate includes",
+			rules: `
+    exclude:
+      - {concurrency: 8}
+    include:
+      - {workload: json, concurrency: 8, profilers: cpu}
+      - {workload: json, concurrency: 8, profilers: cpu}
+      - {concurrency: 8, profilers: cpu}
+      - {workload: json, concurrency: 1}
+`,
+			want: []string{"json/1/none", "json/1/cpu", "sql/1/none", "sql/1/cpu", "json/8/cpu", "sql/8/cpu"},
+		},
+	}
+	for _, tt := range tests {
+		j := parseJob(t, job+tt.rules)
+		var got []string
+		for _, e := range j.Matrix() {
+			got = append(got, fmt.Sprintf("%s/%d/%s", e.Workload, e.Concurrency, e.Profile.Label()))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s:\ngot:  %s\nwant: %s", tt.name, strings.Join(got, " "), strings.Join(tt.want, " "))
+		}
+	}
+}
+
+func TestArgsFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      string
+		overrides string
+		workload  string
+		want      []string
+	}{
+		{
+			name:     "no overrides",
+			args:     `[{a: 1}, {a: 2}]`,
+			workload: "json",
+			want:     []string{`{a: 1}`, `{a: 2}`},
+		},
+		{
+			name:      "other workload",
+			args:      `[{a: 1}]`,
+			overrides: `{sql: {a: 2}}`,
+			workload:  "json",
+			want:      []string{`{a: 1}`},
+		},
+		{
+			name:      "override and add keys",
+			args:      `[{a: 1, b: 1}, {}]`,
+			overrides: `{json: {b: 2, c: 2}}`,
+			workload:  "json",
+			want:      []string{`{a: 1, b: 2, c: 2}`, `{b: 2, c: 2}`},
+		},
+		{
+			name:      "nested mappings are merged",
+			args:      `[{a: 1, db: {host: x, port: 1, opts: {tls: true, pool: 4}}}]`,
+			overrides: `{json: {db: {port: 2, opts: {pool: 8}}}}`,
+			workload:  "json",
+			want:      []string{`{a: 1, db: {host: x, port: 2, opts: {tls: true, pool: 8}}}`},
+		},
+		{
+			name:      "mapping replaced by scalar",
+			args:      `[{db: {host: x}}]`,
+			overrides: `{json: {db: none}}`,
+			workload:  "json",
+			want:      []string{`{db: none}`},
+		},
+		{
+			name:      "scalar replaced by mapping",
+			args:      `[{db: none}]`,
+			overrides: `{json: {db: {host: x}}}`,
+			workload:  "json",
+			want:      []string{`{db: {host: x}}`},
+		},
+		{
+			name:      "aliases",
+			args:      `[&base {db: {host: x}}, *base]`,
+			overrides: `{json: {db: {port: 2}}}`,
+			workload:  "json",
+			want:      []string{`{db: {host: x, port: 2}}`, `{db: {host: x, port: 2}}`},
+		},
+	}
+	for _, tt := range tests {
+		config := "jobs:\n  - args: " + tt.args + "\n"
+		if tt.overrides != "" {
+			config += "    workload_args: " + tt.overrides + "\n"
+		}
+		j := parseJob(t, config)
+
+		var got []string
+		for _, arg := range j.ArgsFor(tt.workload) {
+			var val interface{}
+			if err := arg.Decode(&val); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, fmt.Sprint(val))
+		}
+		var want []string
+		for _, w := range tt.want {
+			var val interface{}
+			if err := yaml.Unmarshal([]byte(w), &val); err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, fmt.Sprint(val))
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%s:\ngot:  %v\nwant: %v", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/bits"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HistogramFile is the name of the file a run's latency histogram is
+// written to when JobConfig.Histogram is enabled.
+const HistogramFile = "histogram.yaml"
+
+// Histogram records durations into log-linear buckets similar to
+// HdrHistogram. The relative error of the recorded values is bounded by the
+// given number of significant decimal digits. Histograms with the same digits
+// can be merged.
+type Histogram struct {
+	Digits int `yaml:"digits"`
+	Count  int `yaml:"count"`
+	// Errors is the number of recorded ops that failed, it's maintained by
+	// the caller.
+	Errors int           `yaml:"errors"`
+	Min    time.Duration `yaml:"min"`
+	Max    time.Duration `yaml:"max"`
+	Sum    time.Duration `yaml:"sum"`
+	// Buckets maps bucket indexes to the number of values recorded in them.
+	Buckets map[int]uint64 `yaml:"buckets"`
+
+	subBits int
+	counts  []uint64
+}
+
+// NewHistogram returns a histogram with the given precision, digits must be
+// between 1 and 5. Its buckets are kept in a slice that grows with the
+// largest value recorded, for values up to 1s it takes about 3 KiB with 1
+// digit, 24 KiB with 2, 170 KiB with 3, 2.1 MiB with 4 and 14 MiB with 5
+// digits, and 10-25% more for values up to 10s.
+func NewHistogram(digits int) (*Histogram, error) {
+	if digits < 1 || digits > 5 {
+		return nil, fmt.Errorf("bad histogram digits=%d: must be between 1 and 5", digits)
+	}
+	h := &Histogram{Digits: digits}
+	h.init()
+	return h, nil
+}
+
+func (h *Histogram) init() {
+	h.subBits = int(math.Ceil(math.Log2(2 * math.Pow10(h.Digits))))
+}
+
+func (h *Histogram) half() int {
+	return 1 << (h.subBits - 1)
+}
+
+// index returns the bucket index for v. Values below 2^subBits get a bucket of
+// their own, above that every power of two is split into half() buckets.
+func (h *Histogram) index(v uint64) int {
+	shift := bits.Len64(v) - h.subBits
+	if shift < 0 {
+		shift = 0
+	}
+	return shift*h.half() + int(v>>uint(shift))
+}
+
+// value returns the highest value that falls into the bucket with index i.
+func (h *Histogram) value(i int) time.Duration {
+	shift := 0
+	if i >= 2*h.half() {
+		shift = i/h.half() - 1
+	}
+	sub := uint64(i - shift*h.half())
+	return time.Duration((sub+1)<<uint(shift) - 1)
+}
+
+// Record adds d to the histogram. Negative durations are recorded as 0.
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := h.index(uint64(d))
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, i+1-len(h.counts))...)
+	}
+	h.counts[i]++
+	if h.Count == 0 || d < h.Min {
+		h.Min = d
+	}
+	if d > h.Max {
+		h.Max = d
+	}
+	h.Count++
+	h.Sum += d
+}
+
+// Merge adds all values recorded by o to h.
+func (h *Histogram) Merge(o *Histogram) error {
+	if h.Digits != o.Digits {
+		return fmt.Errorf("can't merge histograms with digits=%d and digits=%d", h.Digits, o.Digits)
+	} else if o.Count == 0 {
+		h.Errors += o.Errors
+		return nil
+	}
+	if len(o.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, len(o.counts)-len(h.counts))...)
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	if h.Count == 0 || o.Min < h.Min {
+		h.Min = o.Min
+	}
+	if o.Max > h.Max {
+		h.Max = o.Max
+	}
+	h.Count += o.Count
+	h.Errors += o.Errors
+	h.Sum += o.Sum
+	return nil
+}
+
+// Mean returns the exact mean of the recorded values.
+func (h *Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Percentile returns the value below which the given percentage (0-100) of
+// the recorded values fall, within the precision of the histogram.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.Count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			if v := h.value(i); v < h.Max {
+				return v
+			}
+			return h.Max
+		}
+	}
+	return h.Max
+}
+
+// WriteFile writes the histogram to path as YAML.
+func (h *Histogram) WriteFile(path string) error {
+	h.Buckets = map[int]uint64{}
+	for i, c := range h.counts {
+		if c > 0 {
+			h.Buckets[i] = c
+		}
+	}
+	data, err := yaml.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// ReadHistogram reads a histogram written by WriteFile.
+func ReadHistogram(path string) (*Histogram, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	h := &Histogram{}
+	if err := yaml.Unmarshal(data, h); err != nil {
+		return nil, err
+	} else if h.Digits < 1 || h.Digits > 5 {
+		return nil, fmt.Errorf("%s: bad histogram digits=%d", path, h.Digits)
+	}
+	h.init()
+	for i, c := range h.Buckets {
+		if i >= len(h.counts) {
+			h.counts = append(h.counts, make([]uint64, i+1-len(h.counts))...)
+		}
+		h.counts[i] = c
+	}
+	return h, nil
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	for digits := 1; digits <= 4; digits++ {
+		a, err := NewHistogram(digits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := NewHistogram(digits)
+
+		var all []time.Duration
+		for i := 0; i < 10000; i++ {
+			d := time.Duration(rand.ExpFloat64() * float64(time.Millisecond))
+			all = append(all, d)
+			if i%2 == 0 {
+				a.Record(d)
+			} else {
+				b.Record(d)
+			}
+		}
+		if err := a.Merge(b); err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(t.TempDir(), HistogramFile)
+		if err := a.WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		h, err := ReadHistogram(path)
+		if err != nil {
+			t.Fatal(err)
+		} else if h.Count != len(all) {
+			t.Fatalf("got count=%d want=%d", h.Count, len(all))
+		}
+
+		sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+		maxErr := math.Pow10(-digits)
+		for _, p := range []float64{50, 90, 99, 99.9, 100} {
+			want := all[int(math.Ceil(p/100*float64(len(all))))-1]
+			got := h.Percentile(p)
+			if relErr := float64(got-want) / float64(want); math.Abs(relErr) > maxErr {
+				t.Errorf("digits=%d p%v: got=%s want=%s", digits, p, got, want)
+			}
+		}
+	}
+}
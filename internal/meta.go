@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -47,9 +49,55 @@ type RunConfig struct {
 	Iteration   int           `yaml:"iteration"`
 	Concurrency int           `yaml:"concurrency"`
 	Duration    time.Duration `yaml:"duration"`
+	Warmup      time.Duration `yaml:"warmup,omitempty"`
+	Cooldown    time.Duration `yaml:"cooldown,omitempty"`
 	Profile     ProfileConfig `yaml:"profile"`
-	Outdir      string        `yaml:"outdir"`
-	Args        string        `yaml:"args"`
+	Tracing     string        `yaml:"tracing"`
+	Rate        float64       `yaml:"rate,omitempty"`
+	Arrival     string        `yaml:"arrival,omitempty"`
+	Histogram   int           `yaml:"histogram,omitempty"`
+	// MetricsInterval is the runtime/metrics sampling interval, 0 disables
+	// sampling.
+	MetricsInterval time.Duration `yaml:"metrics_interval,omitempty"`
+	PerfCounters    bool          `yaml:"perf_counters,omitempty"`
+	// CPUs is the set of CPUs the run is pinned to when runs are executed
+	// in parallel.
+	CPUs []int `yaml:"cpus,omitempty"`
+	// CPUQuota and MemoryLimit are the cgroup limits of the run.
+	CPUQuota    float64 `yaml:"cpu_quota,omitempty"`
+	MemoryLimit int64   `yaml:"memory_limit,omitempty"`
+	Outdir      string  `yaml:"outdir"`
+	Args        string  `yaml:"args"`
+	// Schedule, Seed and Order record how the run was scheduled, Order is
+	// the position of the run within its session.
+	Schedule string `yaml:"schedule"`
+	Seed     int64  `yaml:"seed,omitempty"`
+	Order    int    `yaml:"order"`
+}
+
+// Instrumentation returns the names of the tracer and profilers enabled for
+// the run, or "none" if there are none. Named profiles are reported by their
+// name instead of their profilers.
+func (rc RunConfig) Instrumentation() []string {
+	var names []string
+	if rc.Tracing != "" && rc.Tracing != TracingNone {
+		names = append(names, rc.Tracing+"-tracing")
+	}
+	profilers := rc.Profile.Profilers()
+	if label := rc.Profile.Label(); label != strings.Join(profilers, ",") {
+		profilers = []string{label}
+	}
+	for _, name := range profilers {
+		if name != "none" || len(names) == 0 {
+			names = append(names, name)
+		}
+	}
+	// Runs shipping their profiles somewhere other than the disk are
+	// reported separately, the sink doesn't matter without profilers.
+	if sink := rc.Profile.Sink; sink != "" && sink != ProfileSinkDisk && profilers[0] != "none" {
+		names = append(names, sink+"-sink")
+	}
+	return names
 }
 
 type RunResult struct {
@@ -58,6 +106,9 @@ type RunResult struct {
 	Duration       time.Duration    `yaml:"duration"`
 	Stats          Stats            `yaml:"stats"`
 	Profiles       []RunProfile     `yaml:"profiles"`
+	TraceAgent     AgentStats       `yaml:"trace_agent,omitempty"`
+	PerfCounters   *PerfCounters    `yaml:"perf_counters,omitempty"`
+	Cgroup         *CgroupStat      `yaml:"cgroup,omitempty"`
 	BeforeRusage   Rusage           `yaml:"before_rusage"`
 	AfterRusage    Rusage           `yaml:"after_rusage"`
 	BeforeMemStats runtime.MemStats `yaml:"before_mem_stats"`
@@ -70,6 +121,37 @@ type Stats struct {
 	MinDuration   time.Duration `yaml:"min_duration"`
 	MaxDuration   time.Duration `yaml:"max_duration"`
 	TotalDuration time.Duration `yaml:"total_duration"`
+	Errors        int           `yaml:"errors"`
+	// Workers holds the stats of the measured ops of every worker, and
+	// Fairness is Jain's fairness index of their op counts. It's 1 if all
+	// workers executed the same number of ops, and 1/n if a single one of
+	// n workers executed all of them.
+	Workers  []WorkerStats `yaml:"workers,omitempty"`
+	Fairness float64       `yaml:"fairness,omitempty"`
+}
+
+// WorkerStats describes the measured ops executed by a single worker.
+type WorkerStats struct {
+	Worker       int           `yaml:"worker"`
+	OpsCount     int           `yaml:"ops_count"`
+	OpsPerSecond float64       `yaml:"ops_per_second"`
+	AvgDuration  time.Duration `yaml:"avg_duration"`
+	MaxDuration  time.Duration `yaml:"max_duration"`
+	Errors       int           `yaml:"errors"`
+}
+
+// Fairness returns Jain's fairness index of the op counts of workers.
+func Fairness(workers []WorkerStats) float64 {
+	var sum, sumSq float64
+	for _, w := range workers {
+		n := float64(w.OpsCount)
+		sum += n
+		sumSq += n * n
+	}
+	if sumSq == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(workers)) * sumSq)
 }
 
 type WorkloadEnv struct {
@@ -78,6 +160,9 @@ type WorkloadEnv struct {
 	GoArch     string `yaml:"go_arch"`
 	GoMaxProcs int    `yaml:"go_max_procs"`
 	GoNumCPU   int    `yaml:"go_num_cpu"`
+	// CPUs is the CPU affinity of the run, it's only recorded for runs that
+	// were pinned to a subset of the CPUs.
+	CPUs []int `yaml:"cpus,omitempty"`
 	// TODO: add kernel version
 }
 
@@ -87,13 +172,42 @@ type RunProfile struct {
 	Start           time.Time     `yaml:"start"`
 	ProfileDuration time.Duration `yaml:"profile_duration,omitempty"`
 	StopDuration    time.Duration `yaml:"stop_duration,omitempty"`
-	Error           string        `yaml:"error,omitempty"`
+	// SinkDuration is the time it took to ship the profile of Bytes size
+	// to the sink of the run after it was stopped.
+	SinkDuration time.Duration `yaml:"sink_duration,omitempty"`
+	Bytes        int64         `yaml:"bytes,omitempty"`
+	Error        string        `yaml:"error,omitempty"`
+	// Stats is set for pprof files by go-observability-report, which writes
+	// them to the file given by its -profile-stats flag.
+	Stats *ProfileStats `yaml:"stats,omitempty"`
+}
+
+// AgentStats describes the payloads received by a fake agent.
+type AgentStats struct {
+	Requests int   `yaml:"requests"`
+	Bytes    int64 `yaml:"bytes"`
 }
 
 type RunOp struct {
 	Start    time.Time     `yaml:"start"`
 	Duration time.Duration `yaml:"duration"`
 	Error    string        `yaml:"error,omitempty"`
+	// Phase is PhaseWarmup or PhaseCooldown for ops that are excluded from
+	// measurement, or "".
+	Phase string `yaml:"phase,omitempty"`
+	// Worker is the index of the worker goroutine that executed the op.
+	Worker int `yaml:"worker"`
+}
+
+const (
+	PhaseWarmup   = "warmup"
+	PhaseCooldown = "cooldown"
+)
+
+// Measured returns true if op was executed during the measured phase of its
+// run.
+func (op RunOp) Measured() bool {
+	return op.Phase == ""
 }
 
 func (op RunOp) ToRecord() []string {
@@ -101,6 +215,8 @@ func (op RunOp) ToRecord() []string {
 		op.Start.Format(time.RFC3339Nano),
 		op.Duration.String(),
 		op.Error,
+		op.Phase,
+		strconv.Itoa(op.Worker),
 	}
 }
 
@@ -118,9 +234,47 @@ func (op *RunOp) FromRecord(row []string) error {
 	op.Duration = duration
 
 	op.Error = row[2]
+	// ops.csv files written before phases were introduced have 3 columns.
+	if len(row) > 3 {
+		op.Phase = row[3]
+	}
+	if len(row) > 4 {
+		if op.Worker, err = strconv.Atoi(row[4]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// PerfCounters holds the perf_event counters of the process for the measured
+// duration of a run. Only user space events are counted, and counts are
+// scaled up if the kernel had to multiplex the hardware counters.
+type PerfCounters struct {
+	Instructions uint64        `yaml:"instructions"`
+	Cycles       uint64        `yaml:"cycles"`
+	CacheMisses  uint64        `yaml:"cache_misses"`
+	BranchMisses uint64        `yaml:"branch_misses"`
+	TaskClock    time.Duration `yaml:"task_clock"`
+	// Unavailable lists the counters that couldn't be opened, e.g. hardware
+	// counters inside of a VM.
+	Unavailable []string `yaml:"unavailable,omitempty"`
+	// Error is set if no counter could be opened.
+	Error string `yaml:"error,omitempty"`
+}
+
+// CgroupStat holds the cpu.stat counters of the cgroup a run was limited by.
+type CgroupStat struct {
+	Usage         time.Duration `yaml:"usage"`
+	User          time.Duration `yaml:"user"`
+	System        time.Duration `yaml:"system"`
+	Periods       int64         `yaml:"periods"`
+	Throttled     int64         `yaml:"throttled"`
+	ThrottledTime time.Duration `yaml:"throttled_time"`
+	// Error is set if the limits couldn't be applied, in which case the run
+	// was executed without them.
+	Error string `yaml:"error,omitempty"`
+}
+
 type Rusage struct {
 	User                       time.Duration `yaml:"user"`
 	System                     time.Duration `yaml:"system"`
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// MetricsFile is the name of the runtime/metrics timeline of a run.
+const MetricsFile = "metrics.csv"
+
+// MetricSample is the value of a runtime/metrics metric at a given time. For
+// histogram metrics Value is 0, and Count and Max describe the values recorded
+// since the previous sample.
+type MetricSample struct {
+	Time  time.Time
+	Name  string
+	Value float64
+	Count uint64
+	// Max is the upper bound of the highest non-empty bucket, or its lower
+	// bound if the upper bound is +Inf.
+	Max float64
+}
+
+var metricsHeader = []string{"time", "name", "value", "count", "max"}
+
+func (s MetricSample) ToRecord() []string {
+	return []string{
+		s.Time.Format(time.RFC3339Nano),
+		s.Name,
+		strconv.FormatFloat(s.Value, 'g', -1, 64),
+		strconv.FormatUint(s.Count, 10),
+		strconv.FormatFloat(s.Max, 'g', -1, 64),
+	}
+}
+
+func (s *MetricSample) FromRecord(row []string) (err error) {
+	if s.Time, err = time.Parse(time.RFC3339Nano, row[0]); err != nil {
+		return err
+	}
+	s.Name = row[1]
+	if s.Value, err = strconv.ParseFloat(row[2], 64); err != nil {
+		return err
+	}
+	if s.Count, err = strconv.ParseUint(row[3], 10, 64); err != nil {
+		return err
+	}
+	s.Max, err = strconv.ParseFloat(row[4], 64)
+	return err
+}
+
+func WriteMetrics(path string, samples []MetricSample) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	cw := csv.NewWriter(file)
+	cw.Write(metricsHeader)
+	for _, s := range samples {
+		cw.Write(s.ToRecord())
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func ReadMetrics(path string) ([]MetricSample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var samples []MetricSample
+	cr := csv.NewReader(file)
+	for isHeader := true; ; isHeader = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		} else if isHeader {
+			continue
+		}
+
+		var s MetricSample
+		if err := s.FromRecord(record); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
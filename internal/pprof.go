@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// minCPUSampleRatio is the fraction of the expected number of CPU samples
+// below which a CPU profile is flagged as an anomaly.
+const minCPUSampleRatio = 0.5
+
+// ProfileStats describes the content of a pprof file.
+type ProfileStats struct {
+	// SampleType is the type and unit of Value, e.g. cpu/nanoseconds.
+	SampleType string `yaml:"sample_type"`
+	// Samples is the sum of the first sample value, e.g. the number of CPU
+	// samples or allocated objects.
+	Samples int64 `yaml:"samples"`
+	// Value is the sum of the last sample value, e.g. CPU time or in-use
+	// bytes.
+	Value int64 `yaml:"value"`
+	// Stacks is the number of unique stack traces.
+	Stacks int `yaml:"stacks"`
+	// Size is the size of the gzip compressed file in bytes.
+	Size int64 `yaml:"size"`
+	// Anomalies describes problems with the profile, e.g. a CPU profile with
+	// far fewer samples than expected.
+	Anomalies []string `yaml:"anomalies,omitempty"`
+}
+
+// ParseProfileStats reads the pprof file at path and returns its stats.
+func ParseProfileStats(path string) (*ProfileStats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ProfileStats{Size: info.Size()}
+	if n := len(prof.SampleType); n > 0 {
+		st := prof.SampleType[n-1]
+		stats.SampleType = st.Type + "/" + st.Unit
+	}
+	stacks := map[string]struct{}{}
+	var key strings.Builder
+	for _, s := range prof.Sample {
+		if len(s.Value) == 0 {
+			continue
+		}
+		stats.Samples += s.Value[0]
+		stats.Value += s.Value[len(s.Value)-1]
+
+		key.Reset()
+		for _, loc := range s.Location {
+			fmt.Fprintf(&key, "%x,", loc.ID)
+		}
+		stacks[key.String()] = struct{}{}
+	}
+	stats.Stacks = len(stacks)
+	return stats, nil
+}
+
+// AnalyzeProfiles sets the Stats of the pprof profiles of the run in dir and
+// flags anomalies. It returns the number of anomalies found. Only m is
+// updated, the meta.yaml of the run is left as is.
+func (m *RunMeta) AnalyzeProfiles(dir string) int {
+	var anomalies int
+	for i := range m.Profiles {
+		p := &m.Profiles[i]
+		if p.File == "" || !strings.HasSuffix(p.File, ".pprof") {
+			continue
+		}
+		stats, err := ParseProfileStats(filepath.Join(dir, p.File))
+		if err != nil {
+			stats = &ProfileStats{Anomalies: []string{fmt.Sprintf("failed to parse: %s", err)}}
+		} else if strings.HasPrefix(p.File, "cpu.") {
+			stats.Anomalies = append(stats.Anomalies, m.cpuAnomalies(p, stats)...)
+		}
+		p.Stats = stats
+		anomalies += len(stats.Anomalies)
+	}
+	return anomalies
+}
+
+// cpuAnomalies compares the number of samples in a CPU profile against the
+// number expected from the CPU time used by the run while it was profiled.
+func (m *RunMeta) cpuAnomalies(p *RunProfile, stats *ProfileStats) []string {
+	if stats.Samples == 0 {
+		return []string{"cpu profile has no samples"}
+	}
+	cpu := (m.AfterRusage.User + m.AfterRusage.System) - (m.BeforeRusage.User + m.BeforeRusage.System)
+	if m.RunConfig.Duration <= 0 || cpu <= 0 {
+		return nil
+	}
+	// Assume the CPU time was spent evenly over the measured duration.
+	profiledCPU := time.Duration(float64(cpu) * float64(p.ProfileDuration) / float64(m.RunConfig.Duration))
+	// The default profiling rate of the runtime is 100 Hz.
+	expected := int64(profiledCPU / (10 * time.Millisecond))
+	if float64(stats.Samples) < minCPUSampleRatio*float64(expected) {
+		return []string{fmt.Sprintf("cpu profile has %d samples, expected ~%d for %s of CPU time", stats.Samples, expected, TruncateDuration(profiledCPU))}
+	}
+	return nil
+}
+
+// FunctionValues reads the pprof file at path and returns the sum of the
+// given sample type for every function, attributing each sample to all
+// functions in its stack. It also returns the total of the sample type.
+func FunctionValues(path, sampleType string) (map[string]int64, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	index := -1
+	for i, st := range prof.SampleType {
+		if st.Type == sampleType {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, 0, fmt.Errorf("%s: no sample type %q", path, sampleType)
+	}
+
+	values := map[string]int64{}
+	var total int64
+	for _, s := range prof.Sample {
+		v := s.Value[index]
+		total += v
+		seen := map[string]bool{}
+		for _, loc := range s.Location {
+			for _, line := range loc.Line {
+				if line.Function == nil || seen[line.Function.Name] {
+					continue
+				}
+				seen[line.Function.Name] = true
+				values[line.Function.Name] += v
+			}
+		}
+	}
+	return values, total, nil
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+func TestFunctionValues(t *testing.T) {
+	fns := map[string]*profile.Function{}
+	var locs []*profile.Location
+	loc := func(names ...string) *profile.Location {
+		l := &profile.Location{ID: uint64(len(locs) + 1)}
+		for _, name := range names {
+			if fns[name] == nil {
+				fns[name] = &profile.Function{ID: uint64(len(fns) + 1), Name: name}
+			}
+			l.Line = append(l.Line, profile.Line{Function: fns[name]})
+		}
+		locs = append(locs, l)
+		return l
+	}
+	a, b, c := loc("a"), loc("b"), loc("c")
+	// inlined is a location of b with a inlined into it.
+	inlined := loc("a", "b")
+
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{a, b}, Value: []int64{1, 10}},
+			{Location: []*profile.Location{b}, Value: []int64{2, 20}},
+			// Recursive stacks count once per function.
+			{Location: []*profile.Location{c, a, c}, Value: []int64{3, 30}},
+			{Location: []*profile.Location{inlined}, Value: []int64{4, 40}},
+		},
+		Location: locs,
+	}
+	for _, fn := range fns {
+		prof.Function = append(prof.Function, fn)
+	}
+	path := filepath.Join(t.TempDir(), "cpu.pprof")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := prof.Write(file); err != nil {
+		t.Fatal(err)
+	} else if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sampleType string
+		values     map[string]int64
+		total      int64
+		err        bool
+	}{
+		{"cpu", map[string]int64{"a": 80, "b": 70, "c": 30}, 100, false},
+		{"samples", map[string]int64{"a": 8, "b": 7, "c": 3}, 10, false},
+		{"alloc_space", nil, 0, true},
+	}
+	for _, tt := range tests {
+		values, total, err := FunctionValues(path, tt.sampleType)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got err %v, want err %v", tt.sampleType, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(values, tt.values) || total != tt.total {
+			t.Errorf("%s: got %v %d, want %v %d", tt.sampleType, values, total, tt.values, tt.total)
+		}
+	}
+}
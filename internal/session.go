@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SessionFile is the name of the session manifest within an outdir.
+const SessionFile = "session.yaml"
+
+// Session is the manifest of a benchmark session. It's updated after every
+// run, so it can be used to resume an interrupted session.
+type Session struct {
+	Config     string       `yaml:"config"`
+	ConfigHash string       `yaml:"config_hash"`
+	Seed       int64        `yaml:"seed"`
+	Start      time.Time    `yaml:"start"`
+	Resumed    []time.Time  `yaml:"resumed,omitempty"`
+	Runs       []SessionRun `yaml:"runs"`
+}
+
+type SessionRun struct {
+	Name   string `yaml:"name"`
+	Status string `yaml:"status"`
+}
+
+const (
+	RunPending = "pending"
+	RunDone    = "done"
+	RunFailed  = "failed"
+)
+
+// Done returns the number of runs with RunDone status.
+func (s *Session) Done() int {
+	var done int
+	for _, run := range s.Runs {
+		if run.Status == RunDone {
+			done++
+		}
+	}
+	return done
+}
+
+// ReadSession reads the session manifest from dir. The returned error
+// satisfies os.IsNotExist if there is no manifest.
+func ReadSession(dir string) (*Session, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, SessionFile))
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{}
+	return s, yaml.Unmarshal(data, s)
+}
+
+// Write atomically replaces the session manifest in dir.
+func (s *Session) Write(dir string) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, SessionFile)
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
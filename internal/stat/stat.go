@@ -0,0 +1,245 @@
+// Package stat implements the statistics used to compare benchmark results:
+// the Mann-Whitney U test, bootstrap confidence intervals and the
+// Holm-Bonferroni correction for multiple comparisons.
+package stat
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Mean returns the arithmetic mean of xs, or NaN if xs is empty.
+func Mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return math.NaN()
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// StdDev returns the sample standard deviation of xs, or NaN if xs has less
+// than two values.
+func StdDev(xs []float64) float64 {
+	if len(xs) < 2 {
+		return math.NaN()
+	}
+	mean := Mean(xs)
+	var sum float64
+	for _, x := range xs {
+		sum += (x - mean) * (x - mean)
+	}
+	return math.Sqrt(sum / float64(len(xs)-1))
+}
+
+// exactLimit is the largest sample size for which MannWhitneyU computes the
+// exact distribution of U.
+const exactLimit = 50
+
+// MannWhitneyU performs a two-sided Mann-Whitney U test of the hypothesis
+// that x and y are drawn from the same distribution. It returns the U
+// statistic of x and the p-value. The p-value is exact for small samples
+// without ties, otherwise a normal approximation with tie and continuity
+// correction is used. The p-value is 1 if either sample is empty.
+func MannWhitneyU(x, y []float64) (u, p float64) {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 0, 1
+	}
+
+	type value struct {
+		v float64
+		x bool
+	}
+	all := make([]value, 0, n1+n2)
+	for _, v := range x {
+		all = append(all, value{v, true})
+	}
+	for _, v := range y {
+		all = append(all, value{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// Assign average ranks to ties and sum up the ranks of x.
+	var rankSum, tieSum float64
+	ties := false
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].x {
+				rankSum += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieSum += t*t*t - t
+		}
+		i = j
+	}
+	u = rankSum - float64(n1*(n1+1))/2
+
+	if !ties && n1+n2 <= exactLimit {
+		return u, exactP(u, n1, n2)
+	}
+
+	n := float64(n1 + n2)
+	mu := float64(n1*n2) / 2
+	sigma := math.Sqrt(float64(n1*n2) / 12 * ((n + 1) - tieSum/(n*(n-1))))
+	if sigma == 0 {
+		return u, 1
+	}
+	z := (math.Abs(u-mu) - 0.5) / sigma
+	if z < 0 {
+		z = 0
+	}
+	return u, math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// MinMannWhitneyP returns the smallest two-sided p-value MannWhitneyU can
+// return for samples of size n1 and n2, reached when they don't overlap. It's
+// 2/C(n1+n2, n1), e.g. 0.1 for 3 values each, 0.0079 for 5 and 0.0022 for 6,
+// or 1 if either sample is empty.
+func MinMannWhitneyP(n1, n2 int) float64 {
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	// C(n1+n2, n1) computed incrementally to avoid overflowing.
+	c := 1.0
+	for i := 1; i <= n1; i++ {
+		c = c * float64(n2+i) / float64(i)
+	}
+	return math.Min(1, 2/c)
+}
+
+// exactP returns the two-sided p-value of u for samples of size n1 and n2
+// without ties.
+func exactP(u float64, n1, n2 int) float64 {
+	// counts[k] is the number of arrangements of the samples with U = k,
+	// built up by adding one value at a time.
+	counts := uDistribution(n1, n2)
+	var total, below, above float64
+	for k, c := range counts {
+		total += c
+		if float64(k) <= u {
+			below += c
+		}
+		if float64(k) >= u {
+			above += c
+		}
+	}
+	return math.Min(1, 2*math.Min(below, above)/total)
+}
+
+// uDistribution returns the number of arrangements of two samples of size n1
+// and n2 for every value of U using the recurrence
+// f(m, n, u) = f(m-1, n, u-n) + f(m, n-1, u).
+func uDistribution(n1, n2 int) []float64 {
+	// f[m][n] is the distribution for samples of size m and n.
+	f := make([][][]float64, n1+1)
+	for m := range f {
+		f[m] = make([][]float64, n2+1)
+		for n := range f[m] {
+			dist := make([]float64, m*n+1)
+			if m == 0 || n == 0 {
+				dist[0] = 1
+			} else {
+				for u := range dist {
+					if u-n >= 0 && u-n < len(f[m-1][n]) {
+						dist[u] += f[m-1][n][u-n]
+					}
+					if u < len(f[m][n-1]) {
+						dist[u] += f[m][n-1][u]
+					}
+				}
+			}
+			f[m][n] = dist
+		}
+	}
+	return f[n1][n2]
+}
+
+// Interval is a confidence interval.
+type Interval struct {
+	Low  float64
+	High float64
+}
+
+// BootstrapRatio returns a percentile bootstrap confidence interval for
+// statistic(y) / statistic(x) by resampling x and y with replacement. The
+// interval is NaN if either sample has less than two values.
+func BootstrapRatio(x, y []float64, statistic func([]float64) float64, confidence float64, resamples int, rng *rand.Rand) Interval {
+	return Bootstrap([][]float64{x, y}, func(s [][]float64) float64 {
+		return statistic(s[1]) / statistic(s[0])
+	}, confidence, resamples, rng)
+}
+
+// Bootstrap returns a percentile bootstrap confidence interval for statistic
+// by resampling each of the samples with replacement. The interval is NaN if
+// any of the samples has less than two values.
+func Bootstrap(samples [][]float64, statistic func([][]float64) float64, confidence float64, resamples int, rng *rand.Rand) Interval {
+	resampled := make([][]float64, len(samples))
+	for i, s := range samples {
+		if len(s) < 2 {
+			return Interval{Low: math.NaN(), High: math.NaN()}
+		}
+		resampled[i] = make([]float64, len(s))
+	}
+	values := make([]float64, resamples)
+	for i := range values {
+		for j, s := range samples {
+			for k := range resampled[j] {
+				resampled[j][k] = s[rng.Intn(len(s))]
+			}
+		}
+		values[i] = statistic(resampled)
+	}
+	sort.Float64s(values)
+	alpha := (1 - confidence) / 2
+	return Interval{
+		Low:  quantile(values, alpha),
+		High: quantile(values, 1-alpha),
+	}
+}
+
+// quantile returns the q-quantile of the sorted xs using linear
+// interpolation.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(i)
+	return sorted[i] + frac*(sorted[i+1]-sorted[i])
+}
+
+// Holm adjusts the p-values of a family of tests with the Holm-Bonferroni
+// method, controlling the family-wise error rate. The adjusted p-values are
+// returned in the order of ps.
+func Holm(ps []float64) []float64 {
+	order := make([]int, len(ps))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return ps[order[i]] < ps[order[j]] })
+
+	adjusted := make([]float64, len(ps))
+	var max float64
+	for rank, i := range order {
+		p := math.Min(1, float64(len(ps)-rank)*ps[i])
+		// Adjusted p-values must not decrease with the rank.
+		if p < max {
+			p = max
+		}
+		max = p
+		adjusted[i] = p
+	}
+	return adjusted
+}
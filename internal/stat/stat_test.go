@@ -0,0 +1,75 @@
+package stat
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		x, y []float64
+		u, p float64
+	}{
+		// Exact distribution.
+		{x: []float64{1, 2, 3}, y: []float64{4, 5, 6}, u: 0, p: 0.1},
+		{x: []float64{1, 2, 3, 4, 5}, y: []float64{6, 7, 8, 9, 10}, u: 0, p: 0.007937},
+		{x: []float64{1, 3, 5, 7}, y: []float64{2, 4, 6, 8}, u: 6, p: 0.685714},
+		// Ties use the normal approximation.
+		{x: []float64{1, 2, 2, 3}, y: []float64{3, 4, 4, 5}, u: 0.5, p: 0.039609},
+		{x: []float64{1, 1, 1}, y: []float64{1, 1, 1}, u: 4.5, p: 1},
+		{x: nil, y: []float64{1}, u: 0, p: 1},
+	}
+	for _, tt := range tests {
+		u, p := MannWhitneyU(tt.x, tt.y)
+		if u != tt.u || math.Abs(p-tt.p) > 1e-6 {
+			t.Errorf("MannWhitneyU(%v, %v) = %v, %v; want %v, %v", tt.x, tt.y, u, p, tt.u, tt.p)
+		}
+	}
+}
+
+func TestMinMannWhitneyP(t *testing.T) {
+	tests := []struct {
+		n1, n2 int
+		p      float64
+	}{
+		{0, 5, 1},
+		{1, 1, 1},
+		{3, 3, 0.1},
+		{5, 5, 0.007937},
+		{6, 6, 0.002165},
+		{4, 8, 0.004040},
+	}
+	for _, tt := range tests {
+		if p := MinMannWhitneyP(tt.n1, tt.n2); math.Abs(p-tt.p) > 1e-6 {
+			t.Errorf("MinMannWhitneyP(%d, %d) = %v; want %v", tt.n1, tt.n2, p, tt.p)
+		}
+	}
+}
+
+func TestBootstrapRatio(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	x := make([]float64, 50)
+	y := make([]float64, 50)
+	for i := range x {
+		x[i] = 100 + rng.NormFloat64()
+		y[i] = 110 + rng.NormFloat64()
+	}
+	ci := BootstrapRatio(x, y, Mean, 0.95, 1000, rng)
+	if !(ci.Low < 1.1 && ci.High > 1.1 && ci.High-ci.Low < 0.01) {
+		t.Errorf("bad interval for ratio 1.1: %+v", ci)
+	}
+	if ci := BootstrapRatio(x[:1], y, Mean, 0.95, 1000, rng); !math.IsNaN(ci.Low) {
+		t.Errorf("expected NaN interval for single value: %+v", ci)
+	}
+}
+
+func TestHolm(t *testing.T) {
+	got := Holm([]float64{0.01, 0.04, 0.03, 0.005})
+	want := []float64{0.03, 0.06, 0.06, 0.02}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Fatalf("Holm() = %v; want %v", got, want)
+		}
+	}
+}
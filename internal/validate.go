@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigError describes a problem with a config at the given path, e.g.
+// "jobs[0].profile[1]".
+type ConfigError struct {
+	Path string
+	// Line is the line of the config file the problem was found at, 0 if
+	// it's unknown.
+	Line int
+	Msg  string
+}
+
+func (e *ConfigError) Error() string {
+	var pos []string
+	if e.Line > 0 {
+		pos = append(pos, fmt.Sprintf("line %d", e.Line))
+	}
+	if e.Path != "" {
+		pos = append(pos, e.Path)
+	}
+	if len(pos) == 0 {
+		return e.Msg
+	}
+	return strings.Join(pos, ": ") + ": " + e.Msg
+}
+
+// CheckConfigKeys returns an error for every key of the yaml config in data
+// that doesn't correspond to a field of Config. Top-level keys starting with
+// an underscore are ignored, they can be used to hold yaml anchors.
+func CheckConfigKeys(data []byte) ([]*ConfigError, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+	var errs []*ConfigError
+	checkKeys(root.Content[0], reflect.TypeOf(Config{}), "", &errs)
+	return errs, nil
+}
+
+// checkKeys recursively compares the mapping keys of n against the fields
+// of the struct type t.
+func checkKeys(n *yaml.Node, t reflect.Type, path string, errs *[]*ConfigError) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if t == reflect.TypeOf(yaml.Node{}) || t == reflect.TypeOf(time.Duration(0)) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		if n.Kind == yaml.MappingNode {
+			// A single value in place of a list, see ProfileSet.
+			checkKeys(n, t.Elem(), path, errs)
+			return
+		} else if n.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range n.Content {
+			checkKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			checkKeys(n.Content[i+1], t.Elem(), path+"."+n.Content[i].Value, errs)
+		}
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "-" || !f.IsExported() {
+				continue
+			} else if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			fields[name] = f.Type
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			if key.Value == "<<" {
+				checkKeys(val, t, path, errs)
+				continue
+			} else if path == "" && strings.HasPrefix(key.Value, "_") {
+				continue
+			}
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				*errs = append(*errs, &ConfigError{Path: path, Line: key.Line, Msg: fmt.Sprintf("unknown key %q", key.Value)})
+				continue
+			}
+			fieldPath := key.Value
+			if path != "" {
+				fieldPath = path + "." + key.Value
+			}
+			checkKeys(val, fieldType, fieldPath, errs)
+		}
+	}
+}
+
+// Validate returns an error for every setting of c that is out of range or
+// unknown. It's expected to be called after the defaults have been set.
+func (c *Config) Validate() []*ConfigError {
+	var errs []*ConfigError
+	add := func(path, format string, args ...interface{}) {
+		errs = append(errs, &ConfigError{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Repeat < 1 {
+		add("repeat", "must be >= 1, got %d", c.Repeat)
+	}
+	switch c.Schedule {
+	case ScheduleSequential, ScheduleRoundRobin, ScheduleRandom:
+	default:
+		add("schedule", "unknown schedule %q", c.Schedule)
+	}
+	if len(c.Jobs) == 0 {
+		add("jobs", "no jobs")
+	}
+
+	for i, j := range c.Jobs {
+		path := fmt.Sprintf("jobs[%d]", i)
+		if j.Name == "" {
+			add(path+".name", "no name")
+		}
+		if len(j.Workload) == 0 && len(j.Include) == 0 {
+			add(path+".workload", "no workloads")
+		}
+		for _, n := range j.Concurrency {
+			if n < 1 {
+				add(path+".concurrency", "must be >= 1, got %d", n)
+			}
+		}
+		if len(j.Duration) == 0 && len(j.Include) == 0 {
+			add(path+".duration", "no durations")
+		}
+		for _, d := range j.Duration {
+			if d <= 0 {
+				add(path+".duration", "must be > 0, got %s", d)
+			}
+		}
+		for _, t := range j.Tracing {
+			switch t {
+			case TracingNone, TracingDatadog, TracingOpenTelemetry:
+			default:
+				add(path+".tracing", "unknown tracing %q", t)
+			}
+		}
+		if len(j.Args) == 0 {
+			add(path+".args", "no args, use [{}] to run the workloads with their default args")
+		}
+		for k, r := range j.Exclude {
+			errs = append(errs, validateRule(j, r, fmt.Sprintf("%s.exclude[%d]", path, k))...)
+		}
+		for k, r := range j.Include {
+			errs = append(errs, validateRule(j, r, fmt.Sprintf("%s.include[%d]", path, k))...)
+		}
+		// Jobs without workloads or durations were reported above.
+		incomplete := len(j.Include) == 0 && (len(j.Workload) == 0 || len(j.Duration) == 0)
+		if !incomplete && len(j.Matrix()) == 0 {
+			switch {
+			case len(j.Include) > 0 && len(j.Exclude) > 0:
+				add(path, "no runs, all combinations are excluded and the include rules match none")
+			case len(j.Include) > 0:
+				add(path, "no runs, the include rules match no combinations")
+			case len(j.Exclude) > 0:
+				add(path, "no runs, all combinations are excluded")
+			default:
+				add(path, "no runs")
+			}
+		}
+		if j.Rate < 0 {
+			add(path+".rate", "must be >= 0, got %g", j.Rate)
+		}
+		if j.Rate > 0 && j.Arrival != ArrivalConstant && j.Arrival != ArrivalPoisson {
+			add(path+".arrival", "unknown arrival %q", j.Arrival)
+		}
+		if j.Histogram != 0 && (j.Histogram < 1 || j.Histogram > 5) {
+			add(path+".histogram", "must be between 1 and 5, got %d", j.Histogram)
+		}
+		for _, d := range []struct {
+			name string
+			d    time.Duration
+		}{{"warmup", j.Warmup}, {"cooldown", j.Cooldown}, {"metrics_interval", j.MetricsInterval}} {
+			if d.d < 0 {
+				add(path+"."+d.name, "must be >= 0, got %s", d.d)
+			}
+		}
+		if j.CPUQuota < 0 {
+			add(path+".cpu_quota", "must be >= 0, got %g", j.CPUQuota)
+		}
+		if j.MemoryLimit < 0 {
+			add(path+".memory_limit", "must be >= 0, got %d", j.MemoryLimit)
+		}
+
+		for k, p := range j.Profile {
+			ppath := fmt.Sprintf("%s.profile[%d]", path, k)
+			if p.Period < 0 {
+				add(ppath+".period", "must be >= 0, got %s", p.Period)
+			}
+			for _, d := range j.Duration {
+				if d > 0 && p.Period > d {
+					add(ppath+".period", "%s is longer than the duration %s", p.Period, d)
+				}
+			}
+			for _, r := range []struct {
+				name string
+				rate int
+			}{{"mem_rate", p.MemRate}, {"block_rate", p.BlockRate}, {"mutex_rate", p.MutexRate}} {
+				if r.rate < 0 {
+					add(ppath+"."+r.name, "must be >= 0, got %d", r.rate)
+				}
+			}
+			// The datadog profiler collects its own CPU profile, and the
+			// runtime only allows one CPU profile at a time.
+			if p.Datadog && p.CPU {
+				add(ppath+".cpu", "can't be combined with datadog")
+			}
+			if p.DatadogCPUDuration < 0 || (p.Period > 0 && p.DatadogCPUDuration > p.Period) {
+				add(ppath+".datadog_cpu_duration", "must be between 0 and the period %s, got %s", p.Period, p.DatadogCPUDuration)
+			}
+			switch p.Sink {
+			case "", ProfileSinkDisk, ProfileSinkDiscard, ProfileSinkHTTP:
+			default:
+				add(ppath+".sink", "unknown sink %q", p.Sink)
+			}
+		}
+	}
+	return errs
+}
+
+// validateRule checks that r of job j has fields set and that its profilers
+// match one of the profiles of j.
+func validateRule(j JobConfig, r MatrixRule, path string) []*ConfigError {
+	if r.IsZero() {
+		return []*ConfigError{{Path: path, Msg: "rule has no fields set"}}
+	}
+	var errs []*ConfigError
+	if r.Concurrency < 0 {
+		errs = append(errs, &ConfigError{Path: path + ".concurrency", Msg: fmt.Sprintf("must be >= 1, got %d", r.Concurrency)})
+	}
+	if r.Duration < 0 {
+		errs = append(errs, &ConfigError{Path: path + ".duration", Msg: fmt.Sprintf("must be > 0, got %s", r.Duration)})
+	}
+	switch r.Tracing {
+	case "", TracingNone, TracingDatadog, TracingOpenTelemetry:
+	default:
+		errs = append(errs, &ConfigError{Path: path + ".tracing", Msg: fmt.Sprintf("unknown tracing %q", r.Tracing)})
+	}
+	if r.Profilers == "" {
+		return errs
+	}
+	var names []string
+	for _, p := range j.Profile {
+		name := p.Label()
+		if name == r.Profilers {
+			return errs
+		}
+		names = append(names, fmt.Sprintf("%q", name))
+	}
+	return append(errs, &ConfigError{Path: path + ".profilers", Msg: fmt.Sprintf("%q matches none of the profiles of the job: %s", r.Profilers, strings.Join(names, ", "))})
+}
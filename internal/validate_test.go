@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckConfigKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name: "known keys",
+			config: `
+_anchors: &duration 1s
+repeat: 2
+profiles:
+  custom: [{cpu: true, period: 1s}]
+jobs:
+  - name: a
+    workload: [json]
+    duration: [*duration]
+    profile: [{}, custom, {mem: true, mem_rate: 1}]
+    args: [{anything: goes}]
+    workload_args: {json: {json_file: x}}
+    include: [{workload: json, profilers: none}]
+`,
+		},
+		{
+			name: "unknown keys",
+			config: `
+repeats: 2
+jobs:
+  - name: a
+    workloads: [json]
+    profile:
+      - {cpu: true, perod: 1s}
+    exclude: [{workload: json, profiler: cpu}]
+`,
+			want: []string{
+				`line 2: unknown key "repeats"`,
+				`line 5: jobs[0]: unknown key "workloads"`,
+				`line 7: jobs[0].profile[0]: unknown key "perod"`,
+				`line 8: jobs[0].exclude[0]: unknown key "profiler"`,
+			},
+		},
+		{
+			name: "unknown keys in profile sets and merges",
+			config: `
+_base: &base {name: a, concurrency: [1], bogus: 1}
+profiles:
+  custom: {cpu: true, cpus: true}
+jobs:
+  - <<: *base
+    workload: [json]
+`,
+			want: []string{
+				`line 4: profiles.custom: unknown key "cpus"`,
+				`line 2: jobs[0]: unknown key "bogus"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		errs, err := CheckConfigKeys([]byte(tt.config))
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		var got []string
+		for _, e := range errs {
+			got = append(got, e.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	const job = `
+jobs:
+  - name: "${workload}"
+    workload: [json]
+    concurrency: [1]
+    duration: [1s]
+    args: [{}]
+`
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name:   "valid",
+			config: job + "    profile: [{}, {cpu: true, period: 100ms}, {datadog: true, mem: true}]\n",
+		},
+		{
+			name:   "no jobs",
+			config: "repeat: -1\nschedule: fifo\n",
+			want: []string{
+				"repeat: must be >= 1, got -1",
+				`schedule: unknown schedule "fifo"`,
+				"jobs: no jobs",
+			},
+		},
+		{
+			name: "empty job",
+			config: `
+jobs:
+  - concurrency: [0]
+`,
+			want: []string{
+				"jobs[0].name: no name",
+				"jobs[0].workload: no workloads",
+				"jobs[0].concurrency: must be >= 1, got 0",
+				"jobs[0].duration: no durations",
+				"jobs[0].args: no args, use [{}] to run the workloads with their default args",
+			},
+		},
+		{
+			name: "bad values",
+			config: `
+jobs:
+  - name: a
+    workload: [json]
+    concurrency: [1]
+    duration: [-1s]
+    args: [{}]
+    tracing: [none, zipkin]
+    rate: 10
+    arrival: burst
+    histogram: 6
+    warmup: -1s
+    cpu_quota: -1
+`,
+			want: []string{
+				"jobs[0].duration: must be > 0, got -1s",
+				`jobs[0].tracing: unknown tracing "zipkin"`,
+				`jobs[0].arrival: unknown arrival "burst"`,
+				"jobs[0].histogram: must be between 1 and 5, got 6",
+				"jobs[0].warmup: must be >= 0, got -1s",
+				"jobs[0].cpu_quota: must be >= 0, got -1",
+			},
+		},
+		{
+			name: "bad profiles",
+			config: job + `    profile:
+      - {cpu: true, period: 2s}
+      - {mem: true, mem_rate: -1, sink: s3}
+      - {datadog: true, cpu: true, period: 100ms, datadog_cpu_duration: 1s}
+`,
+			want: []string{
+				"jobs[0].profile[0].period: 2s is longer than the duration 1s",
+				"jobs[0].profile[1].mem_rate: must be >= 0, got -1",
+				`jobs[0].profile[1].sink: unknown sink "s3"`,
+				"jobs[0].profile[2].cpu: can't be combined with datadog",
+				"jobs[0].profile[2].datadog_cpu_duration: must be between 0 and the period 100ms, got 1s",
+			},
+		},
+		{
+			name: "bad rules",
+			config: job + `    exclude:
+      - {}
+      - {workload: json}
+    include:
+      - {profilers: cpu, tracing: zipkin}
+`,
+			want: []string{
+				"jobs[0].exclude[0]: rule has no fields set",
+				`jobs[0].include[0].tracing: unknown tracing "zipkin"`,
+				`jobs[0].include[0].profilers: "cpu" matches none of the profiles of the job: "none"`,
+				"jobs[0]: no runs, all combinations are excluded and the include rules match none",
+			},
+		},
+		{
+			name:   "everything excluded",
+			config: job + "    exclude: [{workload: json}]\n",
+			want:   []string{"jobs[0]: no runs, all combinations are excluded"},
+		},
+		{
+			name: "includes without durations",
+			config: `
+jobs:
+  - name: a
+    workload: [json]
+    concurrency: [1]
+    args: [{}]
+    include: [{workload: json, concurrency: 2}]
+`,
+			want: []string{"jobs[0]: no runs, the include rules match no combinations"},
+		},
+	}
+	for _, tt := range tests {
+		c := parseConfig(t, tt.config)
+		var got []string
+		for _, e := range c.Validate() {
+			got = append(got, e.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package workload
+
+import "runtime"
+
+// AllocSize allocates the same number of objects in two functions, with the
+// objects of allocLarge being 3x as large as the ones of allocSmall.
+type AllocSize struct {
+	Allocs int `yaml:"allocs"`
+}
+
+// The sizes are size classes of the Go allocator, so no space is lost to
+// rounding.
+const (
+	smallAllocSize = 1024
+	largeAllocSize = 3 * smallAllocSize
+)
+
+func init() {
+	Register("allocsize", func() Workload { return &AllocSize{} }, Meta{
+		Description: "Allocates 1KB objects in allocSmall and 3KB objects in allocLarge for validating memory profiles.",
+		Args: []Arg{
+			{Name: "allocs", Type: "int", Default: "100", Description: "number of allocations per function and op"},
+		},
+	})
+}
+
+func (a *AllocSize) Setup() error {
+	if a.Allocs == 0 {
+		a.Allocs = 100 // allocates 400KB per Run()
+	}
+	return nil
+}
+
+func (a *AllocSize) Run() error {
+	n := allocSmall(a.Allocs, smallAllocSize) + allocLarge(a.Allocs, largeAllocSize)
+	runtime.KeepAlive(n)
+	return nil
+}
+
+func (a *AllocSize) GroundTruth(kind string) *GroundTruth {
+	if kind != "mem" {
+		return nil
+	}
+	return &GroundTruth{
+		SampleType: "alloc_space",
+		Fractions: map[string]float64{
+			funcName(allocSmall): 1.0 / 4,
+			funcName(allocLarge): 3.0 / 4,
+		},
+	}
+}
+
+//go:noinline
+func allocSmall(n, size int) int { return alloc(n, size) }
+
+//go:noinline
+func allocLarge(n, size int) int { return alloc(n, size) }
+
+// alloc allocates n objects of the given size. The size is passed as an
+// argument so that the compiler can't allocate the objects on the stack.
+//
+//go:noinline
+func alloc(n, size int) int {
+	var sum int
+	for i := 0; i < n; i++ {
+		buf := make([]byte, size)
+		buf[i%size] = 1
+		sum += len(buf)
+	}
+	return sum
+}
@@ -8,6 +8,15 @@ type Chan struct {
 	Messages int `yaml:"messages"`
 }
 
+func init() {
+	Register("chan", func() Workload { return &Chan{} }, Meta{
+		Description: "Sends messages between two goroutines over an unbuffered channel.",
+		Args: []Arg{
+			{Name: "messages", Type: "int", Default: "10000", Description: "number of messages per op"},
+		},
+	})
+}
+
 func (h *Chan) Setup() error {
 	if h.Messages == 0 {
 		h.Messages = 10000 // should take ~4ms per Run()
@@ -0,0 +1,94 @@
+package workload
+
+import (
+	"sync"
+	"time"
+)
+
+// Contention waits for a mutex held for a known duration by holdShort and
+// holdLong, and for timers of the same durations in waitShort and waitLong.
+// The long variants take 3x as long as the short ones.
+type Contention struct {
+	Delay time.Duration `yaml:"delay"`
+}
+
+func init() {
+	Register("contention", func() Workload { return &Contention{} }, Meta{
+		Description: "Contends for a mutex and blocks on channels for known durations with a 1:3 ratio for validating mutex and block profiles.",
+		Args: []Arg{
+			{Name: "delay", Type: "time.Duration", Default: "1ms", Description: "duration of the short mutex hold and channel wait, the long ones take 3x as long"},
+		},
+	})
+}
+
+func (c *Contention) Setup() error {
+	if c.Delay == 0 {
+		c.Delay = time.Millisecond // takes about ~8ms per Run()
+	}
+	return nil
+}
+
+func (c *Contention) Run() error {
+	var mu sync.Mutex
+	for _, hold := range []func(*sync.Mutex, chan struct{}, time.Duration){holdShort, holdLong} {
+		locked := make(chan struct{})
+		go hold(&mu, locked, c.Delay)
+		<-locked
+		// The mutex profile attributes the time spent waiting here to the
+		// stack of the goroutine unlocking the mutex.
+		mu.Lock()
+		mu.Unlock()
+	}
+	waitShort(c.Delay)
+	waitLong(c.Delay)
+	return nil
+}
+
+func (c *Contention) GroundTruth(kind string) *GroundTruth {
+	switch kind {
+	case "mutex":
+		return &GroundTruth{
+			SampleType: "delay",
+			Fractions: map[string]float64{
+				funcName(holdShort): 1.0 / 4,
+				funcName(holdLong):  3.0 / 4,
+			},
+		}
+	case "block":
+		return &GroundTruth{
+			SampleType: "delay",
+			Fractions: map[string]float64{
+				funcName(waitShort): 1.0 / 4,
+				funcName(waitLong):  3.0 / 4,
+			},
+		}
+	}
+	return nil
+}
+
+//go:noinline
+func holdShort(mu *sync.Mutex, locked chan struct{}, d time.Duration) { hold(mu, locked, d) }
+
+//go:noinline
+func holdLong(mu *sync.Mutex, locked chan struct{}, d time.Duration) { hold(mu, locked, 3*d) }
+
+// hold locks mu, closes locked and unlocks mu after d.
+func hold(mu *sync.Mutex, locked chan struct{}, d time.Duration) {
+	mu.Lock()
+	close(locked)
+	time.Sleep(d)
+	mu.Unlock()
+}
+
+//go:noinline
+func waitShort(d time.Duration) { wait(d) }
+
+//go:noinline
+func waitLong(d time.Duration) { wait(3 * d) }
+
+// wait blocks on a timer channel for d. Unlike time.Sleep, this shows up in
+// the block profile.
+func wait(d time.Duration) {
+	t := time.NewTimer(d)
+	<-t.C
+}
@@ -0,0 +1,65 @@
+package workload
+
+import "runtime"
+
+// CPURatio burns CPU in three functions with a 1:2:3 ratio, see
+// GroundTruth.
+type CPURatio struct {
+	Iterations int `yaml:"iterations"`
+}
+
+func init() {
+	Register("cpuratio", func() Workload { return &CPURatio{} }, Meta{
+		Description: "Burns CPU in burnA, burnB and burnC with a known 1:2:3 ratio for validating CPU profiles.",
+		Args: []Arg{
+			{Name: "iterations", Type: "int", Default: "200000", Description: "loop iterations of burnA per op, burnB and burnC do 2x and 3x as many"},
+		},
+	})
+}
+
+func (c *CPURatio) Setup() error {
+	if c.Iterations == 0 {
+		c.Iterations = 200000 // takes about ~1ms per Run()
+	}
+	return nil
+}
+
+func (c *CPURatio) Run() error {
+	x := burnA(c.Iterations) + burnB(c.Iterations) + burnC(c.Iterations)
+	runtime.KeepAlive(x)
+	return nil
+}
+
+func (c *CPURatio) GroundTruth(kind string) *GroundTruth {
+	if kind != "cpu" {
+		return nil
+	}
+	return &GroundTruth{
+		SampleType: "cpu",
+		Fractions: map[string]float64{
+			funcName(burnA): 1.0 / 6,
+			funcName(burnB): 2.0 / 6,
+			funcName(burnC): 3.0 / 6,
+		},
+	}
+}
+
+//go:noinline
+func burnA(n int) uint64 { return spin(n) }
+
+//go:noinline
+func burnB(n int) uint64 { return spin(2 * n) }
+
+//go:noinline
+func burnC(n int) uint64 { return spin(3 * n) }
+
+// spin runs a linear congruential generator for n iterations.
+//
+//go:noinline
+func spin(n int) uint64 {
+	var x uint64
+	for i := 0; i < n; i++ {
+		x = x*6364136223846793005 + 1442695040888963407
+	}
+	return x
+}
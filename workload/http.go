@@ -5,23 +5,50 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+
+	"github.com/felixge/go-observability-bench/internal"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/net/http"
 )
 
 type HTTP struct {
-	server *httptest.Server
+	server  *httptest.Server
+	client  *http.Client
+	tracing string
 }
 
 const msg = "Hello World\n"
 
+func init() {
+	Register("http", func() Workload { return &HTTP{} }, Meta{
+		Description: "Sends a GET request to a local HTTP server.",
+	})
+}
+
+func (h *HTTP) Trace(tracing string) error {
+	h.tracing = tracing
+	return nil
+}
+
 func (h *HTTP) Setup() error {
-	h.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+	var handler http.Handler = http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
 		rw.Write([]byte(msg))
-	}))
+	})
+	h.client = http.DefaultClient
+	switch h.tracing {
+	case internal.TracingDatadog:
+		handler = httptrace.WrapHandler(handler, "http-workload", "GET /")
+		h.client = httptrace.WrapClient(&http.Client{})
+	case internal.TracingOpenTelemetry:
+		handler = otelhttp.NewHandler(handler, "GET /")
+		h.client = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	}
+	h.server = httptest.NewServer(handler)
 	return nil
 }
 
 func (h *HTTP) Run() error {
-	resp, err := http.Get(h.server.URL)
+	resp, err := h.client.Get(h.server.URL)
 	if err != nil {
 		return err
 	}
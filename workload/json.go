@@ -10,6 +10,15 @@ type JSON struct {
 	data []byte
 }
 
+func init() {
+	Register("json", func() Workload { return &JSON{} }, Meta{
+		Description: "Decodes and re-encodes a JSON file.",
+		Args: []Arg{
+			{Name: "json_file", Type: "string", Description: "path of the JSON file"},
+		},
+	})
+}
+
 func (j *JSON) Setup() error {
 	data, err := ioutil.ReadFile(j.File)
 	if err != nil {
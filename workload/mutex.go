@@ -9,6 +9,15 @@ type Mutex struct {
 	Ops int `yaml:"ops"`
 }
 
+func init() {
+	Register("mutex", func() Workload { return &Mutex{} }, Meta{
+		Description: "Increments a counter from two goroutines contending for a mutex.",
+		Args: []Arg{
+			{Name: "ops", Type: "int", Default: "100000", Description: "number of increments per op"},
+		},
+	})
+}
+
 func (h *Mutex) Setup() error {
 	if h.Ops == 0 {
 		h.Ops = 100000 // takes about ~1.5ms per Run()
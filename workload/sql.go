@@ -5,13 +5,36 @@ import (
 	"fmt"
 	"time"
 
-	_ "github.com/jackc/pgx/stdlib"
+	"github.com/felixge/go-observability-bench/internal"
+	"github.com/jackc/pgx/stdlib"
+	sqltrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql"
 )
 
 type SQL struct {
 	DSN     string        `yaml:"sql_dsn"`
 	Latency time.Duration `yaml:"sql_latency"`
 	db      *sql.DB
+	tracing string
+}
+
+func init() {
+	Register("sql", func() Workload { return &SQL{} }, Meta{
+		Description: "Runs a query that sleeps on a PostgreSQL server.",
+		Args: []Arg{
+			{Name: "sql_dsn", Type: "string", Description: "PostgreSQL connection string"},
+			{Name: "sql_latency", Type: "time.Duration", Default: "10ms", Description: "unused, the query always sleeps for 10ms"},
+		},
+	})
+}
+
+// Trace enables the database/sql integration of the tracing. There is none
+// for OpenTelemetry.
+func (s *SQL) Trace(tracing string) error {
+	if tracing == internal.TracingOpenTelemetry {
+		return fmt.Errorf("tracing %q has no database/sql integration", tracing)
+	}
+	s.tracing = tracing
+	return nil
 }
 
 func (s *SQL) Setup() error {
@@ -19,7 +42,12 @@ func (s *SQL) Setup() error {
 		s.Latency = 10 * time.Millisecond
 	}
 	var err error
-	s.db, err = sql.Open("pgx", s.DSN)
+	if s.tracing == internal.TracingDatadog {
+		sqltrace.Register("pgx", stdlib.GetDefaultDriver())
+		s.db, err = sqltrace.Open("pgx", s.DSN)
+	} else {
+		s.db, err = sql.Open("pgx", s.DSN)
+	}
 	if err != nil {
 		return err
 	}
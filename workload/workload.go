@@ -1,7 +1,16 @@
+// Package workload implements the workloads executed by the benchmark runner.
+//
+// Additional workloads can be added from other packages by calling Register
+// from an init function and blank-importing the package into a custom build
+// of cmd/go-observability-bench.
 package workload
 
 import (
 	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
 
 	"gopkg.in/yaml.v3"
 )
@@ -11,21 +20,107 @@ type Workload interface {
 	Run() error
 }
 
+// Traceable is implemented by workloads that can enable the tracing
+// integrations for the libraries they use. Trace is called before Setup.
+type Traceable interface {
+	Trace(tracing string) error
+}
+
+// Validatable is implemented by workloads with a known cost distribution
+// that can be used to check the accuracy of the profiles taken while running
+// them.
+type Validatable interface {
+	// GroundTruth returns the expected distribution for the given profile
+	// kind, e.g. "cpu" or "mutex", or nil if it is not known.
+	GroundTruth(kind string) *GroundTruth
+}
+
+// GroundTruth is the expected distribution of a profile sample type over a
+// set of functions.
+type GroundTruth struct {
+	// SampleType is the profile sample type the fractions apply to, e.g.
+	// "cpu" or "alloc_space".
+	SampleType string
+	// Fractions maps fully qualified function names to the fraction of the
+	// sample type expected in stacks containing them. The fractions are
+	// relative to the functions listed and add up to 1.
+	Fractions map[string]float64
+}
+
+// funcName returns the fully qualified name of the function fn.
+func funcName(fn interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+}
+
+// Factory returns a new workload. The args of a run are unmarshaled into it
+// before Setup is called.
+type Factory func() Workload
+
+// Meta describes a workload and its args.
+type Meta struct {
+	Description string
+	Args        []Arg
+}
+
+// Arg describes an arg accepted by a workload.
+type Arg struct {
+	// Name is the yaml key of the arg.
+	Name string
+	// Type is the Go type of the arg, e.g. "int" or "time.Duration".
+	Type string
+	// Default is the value used when the arg is omitted, "" if there is none.
+	Default     string
+	Description string
+}
+
+// Info is a registered workload.
+type Info struct {
+	Meta
+	Name    string
+	Factory Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Info{}
+)
+
+// Register makes a workload available by the given name. It panics if
+// the name is already taken.
+func Register(name string, factory Factory, meta Meta) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("workload: Register called twice for %q", name))
+	}
+	registry[name] = Info{Meta: meta, Name: name, Factory: factory}
+}
+
+// Lookup returns the workload registered by the given name.
+func Lookup(name string) (Info, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	info, ok := registry[name]
+	return info, ok
+}
+
+// Workloads returns all registered workloads sorted by name.
+func Workloads() []Info {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	var infos []Info
+	for _, info := range registry {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
 func New(name string, args []byte) (Workload, error) {
-	var w Workload
-	switch name {
-	case "json":
-		w = &JSON{}
-	case "http":
-		w = &HTTP{}
-	case "chan":
-		w = &Chan{}
-	case "mutex":
-		w = &Mutex{}
-	case "sql":
-		w = &SQL{}
-	default:
+	info, ok := Lookup(name)
+	if !ok {
 		return nil, fmt.Errorf("unknown workload: %q", name)
 	}
+	w := info.Factory()
 	return w, yaml.Unmarshal(args, w)
 }
@@ -1,6 +1,9 @@
 package workload
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func BenchmarkJSON(b *testing.B) {
 	w, err := New("json", []byte("json_file: ../data/small.json"))
@@ -14,3 +17,99 @@ func BenchmarkJSON(b *testing.B) {
 		w.Run()
 	}
 }
+
+func TestGroundTruth(t *testing.T) {
+	tests := []struct {
+		workload   string
+		kind       string
+		sampleType string
+		fractions  map[string]float64
+	}{
+		{"cpuratio", "cpu", "cpu", map[string]float64{"burnA": 1.0 / 6, "burnB": 2.0 / 6, "burnC": 3.0 / 6}},
+		{"cpuratio", "mem", "", nil},
+		{"allocsize", "mem", "alloc_space", map[string]float64{"allocSmall": 1.0 / 4, "allocLarge": 3.0 / 4}},
+		{"allocsize", "cpu", "", nil},
+		{"contention", "mutex", "delay", map[string]float64{"holdShort": 1.0 / 4, "holdLong": 3.0 / 4}},
+		{"contention", "block", "delay", map[string]float64{"waitShort": 1.0 / 4, "waitLong": 3.0 / 4}},
+		{"contention", "cpu", "", nil},
+	}
+	for _, tt := range tests {
+		w, err := New(tt.workload, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		truth := w.(Validatable).GroundTruth(tt.kind)
+		if tt.fractions == nil {
+			if truth != nil {
+				t.Errorf("%s/%s: got %+v, want nil", tt.workload, tt.kind, truth)
+			}
+			continue
+		} else if truth == nil {
+			t.Errorf("%s/%s: got nil", tt.workload, tt.kind)
+			continue
+		}
+
+		if truth.SampleType != tt.sampleType {
+			t.Errorf("%s/%s: got sample type %q, want %q", tt.workload, tt.kind, truth.SampleType, tt.sampleType)
+		}
+		want := map[string]float64{}
+		for fn, f := range tt.fractions {
+			want["github.com/felixge/go-observability-bench/workload."+fn] = f
+		}
+		if !reflect.DeepEqual(truth.Fractions, want) {
+			t.Errorf("%s/%s: got fractions %v, want %v", tt.workload, tt.kind, truth.Fractions, want)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	const name = "test-register"
+	factory := func() Workload { return &Chan{} }
+	Register(name, factory, Meta{Description: "test"})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, name)
+		registryMu.Unlock()
+	}()
+
+	info, ok := Lookup(name)
+	if !ok || info.Name != name || info.Description != "test" {
+		t.Errorf("got %+v, %v, want the registered workload", info, ok)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("registering %q twice didn't panic", name)
+			}
+		}()
+		Register(name, factory, Meta{})
+	}()
+	if info, _ := Lookup(name); info.Description != "test" {
+		t.Errorf("duplicate registration replaced the workload: %+v", info)
+	}
+}
+
+func TestLookupUnknown(t *testing.T) {
+	if _, ok := Lookup("nope"); ok {
+		t.Errorf("Lookup of an unknown workload succeeded")
+	}
+	if _, err := New("nope", nil); err == nil || err.Error() != `unknown workload: "nope"` {
+		t.Errorf("got error %v, want unknown workload", err)
+	}
+}
+
+func TestWorkloads(t *testing.T) {
+	infos := Workloads()
+	if len(infos) == 0 {
+		t.Fatal("no workloads registered")
+	}
+	for i, info := range infos {
+		if i > 0 && infos[i-1].Name >= info.Name {
+			t.Errorf("workloads not sorted: %q before %q", infos[i-1].Name, info.Name)
+		}
+		if got, ok := Lookup(info.Name); !ok || got.Name != info.Name {
+			t.Errorf("Lookup(%q) = %+v, %v", info.Name, got, ok)
+		}
+	}
+}